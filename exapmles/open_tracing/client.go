@@ -4,10 +4,9 @@ import (
     "context"
     "fmt"
     "github.com/opentracing/opentracing-go"
-    "github.com/opentracing/opentracing-go/ext"
     "github.com/opentracing/opentracing-go/log"
+    uHttp "github.com/reaburoa/utils/http"
     "github.com/reaburoa/utils/open_trace"
-    "io/ioutil"
     "net/http"
 )
 
@@ -23,25 +22,10 @@ func main() {
     closer := open_trace.InitTrace(&cfg)
     defer closer.Close()
     
-    // 使用全局的Tracer
-    tracer := opentracing.GlobalTracer()
-    
     ctx := context.Background()
     clientSpan, ctx := opentracing.StartSpanFromContext(ctx, "clientSpan") // 通过context生成Span
     defer clientSpan.Finish()
     
-    url := "http://localhost:8082/publish"
-    req, _ := http.NewRequest("GET", url, nil)
-    
-    // Set some tags on the clientSpan to annotate that it's the client span. The additional HTTP tags are useful for debugging purposes.
-    ext.SpanKindRPCClient.Set(clientSpan)
-    ext.HTTPUrl.Set(clientSpan, url)
-    ext.HTTPMethod.Set(clientSpan, "GET")
-    
-    // Inject the client span context into the headers
-    spanCtx := clientSpan.Context()
-    // 注入trace信息
-    tracer.Inject(spanCtx, opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
     // 设置log信息，需要根据业务自行设定
     clientSpan.LogFields(
         log.String("event", "soft error"),
@@ -50,9 +34,14 @@ func main() {
     )
     clientSpan.SetTag("dddd", "ddd123")
     
-    resp, _ := http.DefaultClient.Do(req)
-    bb, err := ioutil.ReadAll(resp.Body)
+    // ctx 中带有 span 时，http 库会自动创建子 span，设置 url、method、status 等 tag，并把 trace 信息注入到请求头中
+    // 调用 SetTracing(false) 可以关闭
+    url := "http://localhost:8082/publish"
+    client, er := uHttp.NewHttpClient(ctx, url, http.MethodGet, nil)
+    if er != nil {
+        fmt.Println("Http New Client Error ", er)
+        return
+    }
+    bb, err := client.Bytes()
     fmt.Println("body", string(bb), err)
-    
-    defer resp.Body.Close()
 }
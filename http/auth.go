@@ -0,0 +1,454 @@
+package http
+
+import (
+    "context"
+    "crypto/md5"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "hash"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Authenticator adds credentials to every attempt of a request.
+type Authenticator interface {
+    Authenticate(req *http.Request) error
+}
+
+// ChallengeAuthenticator also answers a 401 response, it returns true when the request should be
+// authenticated and sent once more, as Digest and OAuth2 with a rejected token do.
+type ChallengeAuthenticator interface {
+    Authenticator
+    Challenge(req *http.Request, resp *http.Response) (bool, error)
+}
+
+// SetAuth sets the authenticator of the request, nil removes it.
+func (h *HttpClient) SetAuth(auth Authenticator) *HttpClient {
+    h.auth = auth
+
+    return h
+}
+
+func authInterceptor(auth Authenticator) Interceptor {
+    return func(next Doer) Doer {
+        return DoerFunc(func(req *http.Request) (*http.Response, error) {
+            if err := auth.Authenticate(req); err != nil {
+                return nil, err
+            }
+            resp, err := next.Do(req)
+            ca, ok := auth.(ChallengeAuthenticator)
+            if err != nil || !ok || resp.StatusCode != http.StatusUnauthorized {
+                return resp, err
+            }
+            if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+                return resp, nil
+            }
+            retry, err := ca.Challenge(req, resp)
+            if err != nil {
+                drainBody(resp.Body)
+                return nil, err
+            }
+            if !retry {
+                return resp, nil
+            }
+            drainBody(resp.Body)
+            again := req.Clone(req.Context())
+            if req.GetBody != nil {
+                if again.Body, err = req.GetBody(); err != nil {
+                    return nil, err
+                }
+            }
+            if err = auth.Authenticate(again); err != nil {
+                return nil, err
+            }
+            return next.Do(again)
+        })
+    }
+}
+
+// BasicAuth sends HTTP Basic credentials.
+type BasicAuth struct {
+    Username string
+    Password string
+}
+
+func NewBasicAuth(username, password string) *BasicAuth {
+    return &BasicAuth{Username: username, Password: password}
+}
+
+func (a *BasicAuth) Authenticate(req *http.Request) error {
+    req.SetBasicAuth(a.Username, a.Password)
+    return nil
+}
+
+// BearerAuth sends a static bearer token.
+type BearerAuth struct {
+    Token string
+}
+
+func NewBearerAuth(token string) *BearerAuth {
+    return &BearerAuth{Token: token}
+}
+
+func (a *BearerAuth) Authenticate(req *http.Request) error {
+    req.Header.Set("Authorization", "Bearer "+a.Token)
+    return nil
+}
+
+// DigestAuth implements RFC 7616 Digest authentication. The first request gets a 401 challenge,
+// which is answered automatically; later requests reuse the challenge with an increasing nonce count.
+// It supports the MD5 and SHA-256 algorithms, their -sess variants, and the auth and auth-int qop.
+type DigestAuth struct {
+    Username  string
+    Password  string
+    mu        sync.Mutex
+    challenge map[string]string
+    nc        uint32
+}
+
+func NewDigestAuth(username, password string) *DigestAuth {
+    return &DigestAuth{Username: username, Password: password}
+}
+
+func (a *DigestAuth) Authenticate(req *http.Request) error {
+    a.mu.Lock()
+    if a.challenge == nil {
+        a.mu.Unlock()
+        return nil
+    }
+    a.nc++
+    challenge, nc := a.challenge, a.nc
+    a.mu.Unlock()
+    authorization, err := a.authorization(req, challenge, nc)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Authorization", authorization)
+    return nil
+}
+
+func (a *DigestAuth) Challenge(req *http.Request, resp *http.Response) (bool, error) {
+    var challenge map[string]string
+    for _, value := range resp.Header.Values("WWW-Authenticate") {
+        if strings.HasPrefix(strings.ToLower(value), "digest ") {
+            challenge = parseAuthParams(value[len("digest "):])
+            break
+        }
+    }
+    if challenge == nil {
+        return false, nil
+    }
+    // 已经带着摘要认证信息的请求被拒绝，且 nonce 没有过期，说明用户名或密码错误
+    sent := strings.HasPrefix(req.Header.Get("Authorization"), "Digest ")
+    if sent && !strings.EqualFold(challenge["stale"], "true") {
+        return false, nil
+    }
+    a.mu.Lock()
+    a.challenge = challenge
+    a.nc = 0
+    a.mu.Unlock()
+    return true, nil
+}
+
+func (a *DigestAuth) authorization(req *http.Request, c map[string]string, nc uint32) (string, error) {
+    algorithm := c["algorithm"]
+    if algorithm == "" {
+        algorithm = "MD5"
+    }
+    var newHash func() hash.Hash
+    switch strings.ToUpper(strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS")) {
+    case "MD5":
+        newHash = md5.New
+    case "SHA-256":
+        newHash = sha256.New
+    default:
+        return "", fmt.Errorf("http: unsupported digest algorithm %s", algorithm)
+    }
+    h := func(s string) string {
+        hh := newHash()
+        io.WriteString(hh, s)
+        return hex.EncodeToString(hh.Sum(nil))
+    }
+    cnonce := randomHex(16)
+    ncValue := fmt.Sprintf("%08x", nc)
+    uri := req.URL.RequestURI()
+
+    ha1 := h(a.Username + ":" + c["realm"] + ":" + a.Password)
+    if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+        ha1 = h(ha1 + ":" + c["nonce"] + ":" + cnonce)
+    }
+    qop := chooseQop(c["qop"])
+    ha2 := h(req.Method + ":" + uri)
+    if qop == "auth-int" {
+        body := []byte{}
+        if req.GetBody != nil {
+            rc, err := req.GetBody()
+            if err != nil {
+                return "", err
+            }
+            body, err = ioutil.ReadAll(rc)
+            rc.Close()
+            if err != nil {
+                return "", err
+            }
+        }
+        ha2 = h(req.Method + ":" + uri + ":" + h(string(body)))
+    }
+    var response string
+    if qop == "" {
+        response = h(ha1 + ":" + c["nonce"] + ":" + ha2)
+    } else {
+        response = h(ha1 + ":" + c["nonce"] + ":" + ncValue + ":" + cnonce + ":" + qop + ":" + ha2)
+    }
+
+    var b strings.Builder
+    fmt.Fprintf(&b, `Digest username=%q, realm=%q, nonce=%q, uri=%q, algorithm=%s, response=%q`,
+        a.Username, c["realm"], c["nonce"], uri, algorithm, response)
+    if qop != "" {
+        fmt.Fprintf(&b, `, qop=%s, nc=%s, cnonce=%q`, qop, ncValue, cnonce)
+    }
+    if opaque, ok := c["opaque"]; ok {
+        fmt.Fprintf(&b, `, opaque=%q`, opaque)
+    }
+    return b.String(), nil
+}
+
+// chooseQop prefers auth over auth-int among the qop offered by the server.
+func chooseQop(offered string) string {
+    qop := ""
+    for _, q := range strings.Split(offered, ",") {
+        switch strings.TrimSpace(q) {
+        case "auth":
+            return "auth"
+        case "auth-int":
+            qop = "auth-int"
+        }
+    }
+    return qop
+}
+
+// parseAuthParams parses the comma separated key=value pairs of a challenge, values may be quoted.
+func parseAuthParams(s string) map[string]string {
+    params := make(map[string]string)
+    for len(s) > 0 {
+        s = strings.TrimLeft(s, " ,\t")
+        eq := strings.IndexByte(s, '=')
+        if eq < 0 {
+            break
+        }
+        key := strings.ToLower(strings.TrimSpace(s[:eq]))
+        s = strings.TrimLeft(s[eq+1:], " \t")
+        var value string
+        if strings.HasPrefix(s, `"`) {
+            var b strings.Builder
+            i := 1
+            for ; i < len(s) && s[i] != '"'; i++ {
+                if s[i] == '\\' && i+1 < len(s) {
+                    i++
+                }
+                b.WriteByte(s[i])
+            }
+            value = b.String()
+            if i < len(s) {
+                i++
+            }
+            s = s[i:]
+        } else {
+            end := strings.IndexByte(s, ',')
+            if end < 0 {
+                end = len(s)
+            }
+            value = strings.TrimSpace(s[:end])
+            s = s[end:]
+        }
+        params[key] = value
+    }
+    return params
+}
+
+func randomHex(n int) string {
+    b := make([]byte, n)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+// OAuth2ClientCredentials fetches and caches a token by the OAuth2 client credentials grant.
+// The token is refreshed RefreshBefore its expiry, or halfway through its lifetime when that is later,
+// concurrent requests share a single refresh, and a 401 response drops the rejected token and retries once with a new one.
+// TokenURL       获取 token 的地址
+// Scopes         申请的权限范围
+// EndpointParams 额外的请求参数，如 audience
+// AuthInParams   为 true 时 client_id、client_secret 放在请求参数中，否则使用 Basic 认证
+// RefreshBefore  在 token 过期前多长时间刷新，默认 30s，不超过 token 有效期的一半
+// Timeout        获取 token 的超时时间，默认 10s
+// Transport      获取 token 使用的 transport，为空时使用 http.DefaultTransport
+type OAuth2ClientCredentials struct {
+    TokenURL       string
+    ClientID       string
+    ClientSecret   string
+    Scopes         []string
+    EndpointParams url.Values
+    AuthInParams   bool
+    RefreshBefore  time.Duration
+    Timeout        time.Duration
+    Transport      http.RoundTripper
+
+    mu        sync.Mutex
+    token     string
+    tokenType string
+    expiry    time.Time
+    lifetime  time.Duration
+    inflight  *tokenCall
+}
+
+type tokenCall struct {
+    done chan struct{}
+    err  error
+}
+
+func NewOAuth2ClientCredentials(tokenURL, clientID, clientSecret string, scopes ...string) *OAuth2ClientCredentials {
+    return &OAuth2ClientCredentials{
+        TokenURL:     tokenURL,
+        ClientID:     clientID,
+        ClientSecret: clientSecret,
+        Scopes:       scopes,
+    }
+}
+
+func (o *OAuth2ClientCredentials) Authenticate(req *http.Request) error {
+    tokenType, token, err := o.Token(req.Context())
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Authorization", tokenType+" "+token)
+    return nil
+}
+
+func (o *OAuth2ClientCredentials) Challenge(req *http.Request, resp *http.Response) (bool, error) {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    // 只有使用当前缓存的 token 被拒绝时才清除，其他请求已经清除或者换过的 token 直接重试，避免重复刷新
+    if req.Header.Get("Authorization") != o.tokenType+" "+o.token {
+        return true, nil
+    }
+    o.token = ""
+    return true, nil
+}
+
+// Token returns a valid token, fetching a new one when the cached one is missing or about to expire.
+func (o *OAuth2ClientCredentials) Token(ctx context.Context) (tokenType, token string, err error) {
+    refreshBefore := o.RefreshBefore
+    if refreshBefore <= 0 {
+        refreshBefore = 30 * time.Second
+    }
+    o.mu.Lock()
+    // 有效期很短的 token 不能一获取到就被当作快要过期
+    if o.lifetime > 0 && refreshBefore > o.lifetime/2 {
+        refreshBefore = o.lifetime / 2
+    }
+    if o.token != "" && (o.expiry.IsZero() || time.Now().Add(refreshBefore).Before(o.expiry)) {
+        tokenType, token = o.tokenType, o.token
+        o.mu.Unlock()
+        return tokenType, token, nil
+    }
+    call := o.inflight
+    if call == nil {
+        call = &tokenCall{done: make(chan struct{})}
+        o.inflight = call
+        go o.refresh(call)
+    }
+    o.mu.Unlock()
+
+    select {
+    case <-ctx.Done():
+        return "", "", ctx.Err()
+    case <-call.done:
+    }
+    if call.err != nil {
+        return "", "", call.err
+    }
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    return o.tokenType, o.token, nil
+}
+
+// refresh fetches a token independently of the context of the caller, so that one cancelled request
+// does not fail the others waiting for the same refresh.
+func (o *OAuth2ClientCredentials) refresh(call *tokenCall) {
+    tokenType, token, lifetime, err := o.fetch()
+    o.mu.Lock()
+    if err == nil {
+        o.tokenType, o.token, o.lifetime = tokenType, token, lifetime
+        o.expiry = time.Time{}
+        if lifetime > 0 {
+            o.expiry = time.Now().Add(lifetime)
+        }
+    }
+    o.inflight = nil
+    call.err = err
+    o.mu.Unlock()
+    close(call.done)
+}
+
+// fetch returns the token and its lifetime, 0 when the server sends no expires_in.
+func (o *OAuth2ClientCredentials) fetch() (tokenType, token string, lifetime time.Duration, err error) {
+    timeout := o.Timeout
+    if timeout <= 0 {
+        timeout = 10 * time.Second
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+    h, err := NewHttpClient(ctx, o.TokenURL, http.MethodPost, o.Transport)
+    if err != nil {
+        return "", "", 0, err
+    }
+    h.Param("grant_type", "client_credentials").Header("Accept", "application/json").SetErrorOnStatus(true)
+    if len(o.Scopes) > 0 {
+        h.Param("scope", strings.Join(o.Scopes, " "))
+    }
+    for k, vs := range o.EndpointParams {
+        for _, v := range vs {
+            h.Param(k, v)
+        }
+    }
+    if o.AuthInParams {
+        h.Param("client_id", o.ClientID).Param("client_secret", o.ClientSecret)
+    } else {
+        h.SetAuth(NewBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret)))
+    }
+    var body struct {
+        AccessToken string      `json:"access_token"`
+        TokenType   string      `json:"token_type"`
+        ExpiresIn   interface{} `json:"expires_in"`
+    }
+    if err = h.ToJSON(&body); err != nil {
+        return "", "", 0, fmt.Errorf("http: fetch oauth2 token: %w", err)
+    }
+    if body.AccessToken == "" {
+        return "", "", 0, errors.New("http: oauth2 token response has no access_token")
+    }
+    tokenType = body.TokenType
+    if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+        tokenType = "Bearer"
+    }
+    var seconds int64
+    switch v := body.ExpiresIn.(type) {
+    case float64:
+        seconds = int64(v)
+    case string:
+        seconds, _ = strconv.ParseInt(v, 10, 64)
+    }
+    if seconds > 0 {
+        lifetime = time.Duration(seconds) * time.Second
+    }
+    return tokenType, body.AccessToken, lifetime, nil
+}
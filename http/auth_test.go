@@ -0,0 +1,304 @@
+package http
+
+import (
+    "context"
+    "crypto/md5"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "hash"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestBasicAuth(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if u, p, ok := r.BasicAuth(); !ok || u != "tom" || p != "secret" {
+            w.WriteHeader(http.StatusUnauthorized)
+        }
+    }))
+    defer srv.Close()
+
+    h, _ := Get(srv.URL)
+    resp, err := h.SetAuth(NewBasicAuth("tom", "secret")).Response()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("status = %d", resp.StatusCode)
+    }
+}
+
+func TestBearerAuth(t *testing.T) {
+    var got string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        got = r.Header.Get("Authorization")
+    }))
+    defer srv.Close()
+
+    h, _ := Get(srv.URL)
+    if _, err := h.SetAuth(NewBearerAuth("abc")).Bytes(); err != nil {
+        t.Fatal(err)
+    }
+    if got != "Bearer abc" {
+        t.Fatalf("Authorization = %q", got)
+    }
+}
+
+// digestServer checks RFC 7616 credentials with qop auth, rotateNonce makes every nonce valid once,
+// so that the next request gets a stale challenge.
+type digestServer struct {
+    algorithm   string
+    password    string
+    rotateNonce bool
+    mu          sync.Mutex
+    nonce       int
+    requests    int32
+}
+
+func (s *digestServer) challenge(w http.ResponseWriter, stale bool) {
+    w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="test", qop="auth", algorithm=%s, nonce="n%d", opaque="op", stale=%v`,
+        s.algorithm, s.nonce, stale))
+    w.WriteHeader(http.StatusUnauthorized)
+}
+
+func (s *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    atomic.AddInt32(&s.requests, 1)
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    auth := r.Header.Get("Authorization")
+    if !strings.HasPrefix(auth, "Digest ") {
+        s.challenge(w, false)
+        return
+    }
+    p := parseAuthParams(auth[len("Digest "):])
+    newHash := newDigestHash(s.algorithm)
+    h := func(v string) string {
+        hh := newHash()
+        hh.Write([]byte(v))
+        return hex.EncodeToString(hh.Sum(nil))
+    }
+    ha1 := h("tom:test:" + s.password)
+    ha2 := h(r.Method + ":" + p["uri"])
+    want := h(ha1 + ":" + p["nonce"] + ":" + p["nc"] + ":" + p["cnonce"] + ":" + p["qop"] + ":" + ha2)
+    if p["response"] != want || p["opaque"] != "op" || p["uri"] != r.URL.RequestURI() {
+        s.challenge(w, false)
+        return
+    }
+    if p["nonce"] != fmt.Sprintf("n%d", s.nonce) {
+        s.challenge(w, true)
+        return
+    }
+    if s.rotateNonce {
+        s.nonce++
+    }
+    fmt.Fprint(w, "ok")
+}
+
+func newDigestHash(algorithm string) func() hash.Hash {
+    if algorithm == "SHA-256" {
+        return sha256.New
+    }
+    return md5.New
+}
+
+func TestDigestAuth(t *testing.T) {
+    for _, algorithm := range []string{"MD5", "SHA-256"} {
+        t.Run(algorithm, func(t *testing.T) {
+            ds := &digestServer{algorithm: algorithm, password: "secret"}
+            srv := httptest.NewServer(ds)
+            defer srv.Close()
+
+            auth := NewDigestAuth("tom", "secret")
+            for i := 0; i < 3; i++ {
+                h, _ := Get(srv.URL + "/data?page=1")
+                body, err := h.SetAuth(auth).Bytes()
+                if err != nil || string(body) != "ok" {
+                    t.Fatalf("request %d: %q, %v", i, body, err)
+                }
+            }
+            // 只有第一个请求需要应答 401 质询
+            if n := atomic.LoadInt32(&ds.requests); n != 4 {
+                t.Fatalf("server got %d requests, want 4", n)
+            }
+        })
+    }
+}
+
+func TestDigestAuthStaleNonce(t *testing.T) {
+    ds := &digestServer{algorithm: "MD5", password: "secret", rotateNonce: true}
+    srv := httptest.NewServer(ds)
+    defer srv.Close()
+
+    auth := NewDigestAuth("tom", "secret")
+    for i := 0; i < 3; i++ {
+        h, _ := Get(srv.URL)
+        if body, err := h.SetAuth(auth).Bytes(); err != nil || string(body) != "ok" {
+            t.Fatalf("request %d: %q, %v", i, body, err)
+        }
+    }
+}
+
+func TestDigestAuthWrongPassword(t *testing.T) {
+    ds := &digestServer{algorithm: "MD5", password: "secret"}
+    srv := httptest.NewServer(ds)
+    defer srv.Close()
+
+    h, _ := Get(srv.URL)
+    resp, err := h.SetAuth(NewDigestAuth("tom", "wrong")).Response()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resp.StatusCode != http.StatusUnauthorized {
+        t.Fatalf("status = %d, want 401", resp.StatusCode)
+    }
+    if n := atomic.LoadInt32(&ds.requests); n != 2 {
+        t.Fatalf("server got %d requests, want 2", n)
+    }
+}
+
+// tokenServer issues tok1, tok2... by the client credentials grant.
+type tokenServer struct {
+    expiresIn int
+    delay     time.Duration
+    fetches   int32
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    id, secret, _ := r.BasicAuth()
+    r.ParseForm()
+    if id != "app" || secret != "s3cret" || r.PostForm.Get("grant_type") != "client_credentials" {
+        w.WriteHeader(http.StatusUnauthorized)
+        return
+    }
+    n := atomic.AddInt32(&s.fetches, 1)
+    time.Sleep(s.delay)
+    w.Header().Set("Content-Type", "application/json")
+    fmt.Fprintf(w, `{"access_token":"tok%d","token_type":"bearer","expires_in":%d}`, n, s.expiresIn)
+}
+
+func TestOAuth2SingleFlight(t *testing.T) {
+    ts := &tokenServer{expiresIn: 3600, delay: 50 * time.Millisecond}
+    tokenSrv := httptest.NewServer(ts)
+    defer tokenSrv.Close()
+    api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") != "Bearer tok1" {
+            w.WriteHeader(http.StatusUnauthorized)
+        }
+    }))
+    defer api.Close()
+
+    auth := NewOAuth2ClientCredentials(tokenSrv.URL, "app", "s3cret", "read")
+    var wg sync.WaitGroup
+    errs := make(chan error, 20)
+    for i := 0; i < 20; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            h, _ := Get(api.URL)
+            resp, err := h.SetAuth(auth).SetErrorOnStatus(true).Response()
+            if err == nil {
+                resp.Body.Close()
+            }
+            errs <- err
+        }()
+    }
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+    if n := atomic.LoadInt32(&ts.fetches); n != 1 {
+        t.Fatalf("token fetched %d times, want 1", n)
+    }
+}
+
+func TestOAuth2ShortLivedToken(t *testing.T) {
+    ts := &tokenServer{expiresIn: 20}
+    tokenSrv := httptest.NewServer(ts)
+    defer tokenSrv.Close()
+
+    auth := NewOAuth2ClientCredentials(tokenSrv.URL, "app", "s3cret")
+    for i := 0; i < 5; i++ {
+        if _, token, err := auth.Token(context.Background()); err != nil || token != "tok1" {
+            t.Fatalf("token %q, %v", token, err)
+        }
+    }
+}
+
+func TestOAuth2RejectedToken(t *testing.T) {
+    ts := &tokenServer{expiresIn: 3600}
+    tokenSrv := httptest.NewServer(ts)
+    defer tokenSrv.Close()
+    // tok1 被服务端吊销
+    api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") == "Bearer tok1" {
+            w.WriteHeader(http.StatusUnauthorized)
+        }
+    }))
+    defer api.Close()
+
+    auth := NewOAuth2ClientCredentials(tokenSrv.URL, "app", "s3cret")
+    h, _ := Get(api.URL)
+    resp, err := h.SetAuth(auth).Response()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resp.StatusCode != http.StatusOK || atomic.LoadInt32(&ts.fetches) != 2 {
+        t.Fatalf("status %d after %d token fetches", resp.StatusCode, ts.fetches)
+    }
+}
+
+func TestOAuth2ConcurrentRejections(t *testing.T) {
+    ts := &tokenServer{expiresIn: 3600, delay: 100 * time.Millisecond}
+    tokenSrv := httptest.NewServer(ts)
+    defer tokenSrv.Close()
+    // 两个请求都带着 tok1 到达后才一起返回 401
+    var arrived sync.WaitGroup
+    arrived.Add(2)
+    api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") == "Bearer tok1" {
+            arrived.Done()
+            arrived.Wait()
+            w.WriteHeader(http.StatusUnauthorized)
+        }
+    }))
+    defer api.Close()
+
+    auth := NewOAuth2ClientCredentials(tokenSrv.URL, "app", "s3cret")
+    if _, _, err := auth.Token(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    var wg sync.WaitGroup
+    statuses := make(chan int, 2)
+    for i := 0; i < 2; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            h, _ := Get(api.URL)
+            resp, err := h.SetAuth(auth).Response()
+            if err != nil {
+                t.Error(err)
+                return
+            }
+            statuses <- resp.StatusCode
+        }()
+    }
+    wg.Wait()
+    close(statuses)
+    for status := range statuses {
+        if status != http.StatusOK {
+            t.Fatalf("status = %d", status)
+        }
+    }
+    if n := atomic.LoadInt32(&ts.fetches); n != 2 {
+        t.Fatalf("token fetched %d times, want 2", n)
+    }
+}
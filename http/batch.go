@@ -0,0 +1,162 @@
+package http
+
+import (
+    "context"
+    "sync"
+    "time"
+)
+
+// BatchRequest builds one request of a batch, it must build the client with ctx
+// so that the batch can cancel it, e.g. NewHttpClient(ctx, ...) or client.R().SetContext(ctx).
+type BatchRequest func(ctx context.Context) (*HttpClient, error)
+
+// BatchResult is the outcome of one request, at the index of its builder.
+// Err is the error of building or sending the request, set SetErrorOnStatus to count non-2xx responses as errors.
+type BatchResult struct {
+    Index    int
+    Client   *HttpClient
+    Body     []byte
+    Err      error
+    Duration time.Duration
+}
+
+// BatchReport holds the results in input order and the timing of the whole batch.
+// Requests that never started because the batch was cancelled have Err set and Duration 0.
+type BatchReport struct {
+    Results    []BatchResult
+    Succeeded  int
+    Failed     int
+    Elapsed    time.Duration
+    MinLatency time.Duration
+    MaxLatency time.Duration
+    AvgLatency time.Duration
+}
+
+// Errors returns the errors of the failed requests in input order.
+func (r *BatchReport) Errors() []error {
+    var errs []error
+    for _, result := range r.Results {
+        if result.Err != nil {
+            errs = append(errs, result.Err)
+        }
+    }
+    return errs
+}
+
+// Batch runs many requests with bounded concurrency.
+//     report, err := uHttp.NewBatch(8).SetFailFast(true).Run(ctx, requests)
+type Batch struct {
+    concurrency int
+    failFast    bool
+    onResult    func(result BatchResult)
+}
+
+// NewBatch creates a batch running at most concurrency requests at a time, at least 1.
+func NewBatch(concurrency int) *Batch {
+    if concurrency < 1 {
+        concurrency = 1
+    }
+    return &Batch{concurrency: concurrency}
+}
+
+// SetFailFast cancels the remaining requests after the first failure, which Run then returns.
+// Otherwise every request runs and the failures are only reported in the results.
+func (b *Batch) SetFailFast(on bool) *Batch {
+    b.failFast = on
+
+    return b
+}
+
+// SetOnResult sets a function called as soon as each request finishes, from the goroutine running it.
+func (b *Batch) SetOnResult(fn func(result BatchResult)) *Batch {
+    b.onResult = fn
+
+    return b
+}
+
+// Run sends the requests and waits for all of them. The error is the first failure in fail-fast mode,
+// or the error of ctx when it ends before the batch does.
+func (b *Batch) Run(ctx context.Context, requests []BatchRequest) (*BatchReport, error) {
+    start := time.Now()
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    report := &BatchReport{Results: make([]BatchResult, len(requests))}
+    var (
+        once     sync.Once
+        firstErr error
+        wg       sync.WaitGroup
+    )
+    jobs := make(chan int)
+    workers := b.concurrency
+    if workers > len(requests) {
+        workers = len(requests)
+    }
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range jobs {
+                result := runBatchRequest(ctx, i, requests[i])
+                report.Results[i] = result
+                if result.Err != nil && b.failFast {
+                    once.Do(func() {
+                        firstErr = result.Err
+                        cancel()
+                    })
+                }
+                if b.onResult != nil {
+                    b.onResult(result)
+                }
+            }
+        }()
+    }
+    for i := range requests {
+        jobs <- i
+    }
+    close(jobs)
+    wg.Wait()
+
+    var total time.Duration
+    ran := 0
+    for _, result := range report.Results {
+        if result.Err != nil {
+            report.Failed++
+        } else {
+            report.Succeeded++
+        }
+        if result.Duration == 0 {
+            continue
+        }
+        ran++
+        total += result.Duration
+        if report.MinLatency == 0 || result.Duration < report.MinLatency {
+            report.MinLatency = result.Duration
+        }
+        if result.Duration > report.MaxLatency {
+            report.MaxLatency = result.Duration
+        }
+    }
+    if ran > 0 {
+        report.AvgLatency = total / time.Duration(ran)
+    }
+    report.Elapsed = time.Since(start)
+    if firstErr != nil {
+        return report, firstErr
+    }
+    return report, ctx.Err()
+}
+
+func runBatchRequest(ctx context.Context, i int, build BatchRequest) BatchResult {
+    result := BatchResult{Index: i}
+    if result.Err = ctx.Err(); result.Err != nil {
+        return result
+    }
+    start := time.Now()
+    result.Client, result.Err = build(ctx)
+    if result.Err == nil {
+        result.Body, result.Err = result.Client.Bytes()
+    }
+    result.Duration = time.Since(start)
+    return result
+}
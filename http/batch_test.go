@@ -0,0 +1,130 @@
+package http
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// batchServer answers /{n} with n after a short delay, /fail/{n} with 500, and records the peak concurrency.
+func batchServer() (*httptest.Server, *int32) {
+    var inFlight, peak int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        n := atomic.AddInt32(&inFlight, 1)
+        defer atomic.AddInt32(&inFlight, -1)
+        for {
+            p := atomic.LoadInt32(&peak)
+            if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+                break
+            }
+        }
+        time.Sleep(10 * time.Millisecond)
+        if strings.HasPrefix(r.URL.Path, "/fail/") {
+            w.WriteHeader(http.StatusInternalServerError)
+            return
+        }
+        w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/")))
+    }))
+    return srv, &peak
+}
+
+func batchRequests(base string, paths ...string) []BatchRequest {
+    requests := make([]BatchRequest, len(paths))
+    for i, path := range paths {
+        u := base + path
+        requests[i] = func(ctx context.Context) (*HttpClient, error) {
+            h, err := NewHttpClient(ctx, u, http.MethodGet, nil)
+            if err != nil {
+                return nil, err
+            }
+            return h.SetErrorOnStatus(true), nil
+        }
+    }
+    return requests
+}
+
+func TestBatchRun(t *testing.T) {
+    srv, peak := batchServer()
+    defer srv.Close()
+
+    var paths []string
+    for i := 0; i < 20; i++ {
+        if i%5 == 3 {
+            paths = append(paths, fmt.Sprintf("/fail/%d", i))
+        } else {
+            paths = append(paths, fmt.Sprintf("/%d", i))
+        }
+    }
+    // 构造请求失败也计入结果
+    requests := append(batchRequests(srv.URL, paths...), func(ctx context.Context) (*HttpClient, error) {
+        return nil, errors.New("build failed")
+    })
+    var (
+        mu       sync.Mutex
+        finished int
+    )
+    report, err := NewBatch(4).SetOnResult(func(result BatchResult) {
+        mu.Lock()
+        finished++
+        mu.Unlock()
+    }).Run(context.Background(), requests)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if p := atomic.LoadInt32(peak); p > 4 || p < 2 {
+        t.Fatalf("peak concurrency %d", p)
+    }
+    if finished != len(requests) || report.Succeeded != 16 || report.Failed != 5 {
+        t.Fatalf("%d finished, %d succeeded, %d failed", finished, report.Succeeded, report.Failed)
+    }
+    for i, result := range report.Results[:20] {
+        if result.Index != i || (result.Err == nil) != (string(result.Body) == strconv.Itoa(i)) {
+            t.Fatalf("result %d: %+v", i, result)
+        }
+    }
+    errs := report.Errors()
+    var httpErr *HTTPError
+    if len(errs) != 5 || !errors.As(errs[0], &httpErr) || !strings.HasSuffix(httpErr.URL, "/fail/3") ||
+        errs[4].Error() != "build failed" {
+        t.Fatalf("errors = %v", errs)
+    }
+    if report.MinLatency <= 0 || report.MinLatency > report.AvgLatency || report.AvgLatency > report.MaxLatency ||
+        report.Elapsed < report.MaxLatency {
+        t.Fatalf("latency min %s avg %s max %s elapsed %s", report.MinLatency, report.AvgLatency, report.MaxLatency, report.Elapsed)
+    }
+}
+
+func TestBatchFailFast(t *testing.T) {
+    srv, _ := batchServer()
+    defer srv.Close()
+
+    report, err := NewBatch(1).SetFailFast(true).Run(context.Background(), batchRequests(srv.URL, "/0", "/fail/1", "/2", "/3"))
+    var httpErr *HTTPError
+    if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusInternalServerError {
+        t.Fatalf("got %v", err)
+    }
+    if report.Succeeded != 1 || report.Failed != 3 {
+        t.Fatalf("%d succeeded, %d failed", report.Succeeded, report.Failed)
+    }
+    // 未开始的请求是取消错误，也不计入延迟
+    for _, result := range report.Results[2:] {
+        if !errors.Is(result.Err, context.Canceled) || result.Duration != 0 {
+            t.Fatalf("result %d: %+v", result.Index, result)
+        }
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    report, err = NewBatch(2).Run(ctx, batchRequests(srv.URL, "/0", "/1"))
+    if !errors.Is(err, context.Canceled) || report.Failed != 2 {
+        t.Fatalf("got %v, %d failed", err, report.Failed)
+    }
+}
@@ -0,0 +1,272 @@
+package http
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "sync"
+    "time"
+)
+
+// CircuitState 熔断器状态
+type CircuitState int
+
+const (
+    StateClosed CircuitState = iota
+    StateOpen
+    StateHalfOpen
+)
+
+func (s CircuitState) String() string {
+    switch s {
+    case StateClosed:
+        return "closed"
+    case StateOpen:
+        return "open"
+    case StateHalfOpen:
+        return "half-open"
+    }
+    return "unknown"
+}
+
+// ErrCircuitOpen is matched by errors.Is for every request rejected by an open circuit.
+var ErrCircuitOpen = errors.New("http: circuit breaker is open")
+
+// CircuitOpenError is returned without dialing when the circuit of the host is open.
+type CircuitOpenError struct {
+    Host  string
+    State CircuitState
+}
+
+func (e *CircuitOpenError) Error() string {
+    return fmt.Sprintf("http: circuit breaker is %s for host %s", e.State, e.Host)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+    return target == ErrCircuitOpen
+}
+
+// BreakerConfig 熔断器配置
+// ConsecutiveFailures 连续失败多少次后熔断，0 表示不按连续失败熔断
+// FailureRate         滑动窗口内失败率达到多少后熔断，取值 (0, 1]，0 表示不按失败率熔断
+// MinRequests         滑动窗口内请求数达到多少后才计算失败率，默认 10
+// Window              滑动窗口长度，默认 10s，最小 10ms
+// OpenTimeout         熔断持续多长时间后进入半开状态，默认 30s
+// HalfOpenRequests    半开状态下允许通过的探测请求数，全部成功后恢复，默认 1
+// IsFailure           判断一次请求是否失败，默认请求出错或者响应状态码 >= 500
+// OnStateChange       状态变更回调，可以用来通过 logger.Sugar 记录日志
+type BreakerConfig struct {
+    ConsecutiveFailures int
+    FailureRate         float64
+    MinRequests         int
+    Window              time.Duration
+    OpenTimeout         time.Duration
+    HalfOpenRequests    int
+    IsFailure           func(resp *http.Response, err error) bool
+    OnStateChange       func(host string, from, to CircuitState)
+}
+
+const breakerBuckets = 10
+
+// CircuitBreaker keeps one circuit per host, it is safe for concurrent use and meant to be shared.
+type CircuitBreaker struct {
+    cfg   BreakerConfig
+    mu    sync.Mutex
+    hosts map[string]*circuit
+}
+
+type circuit struct {
+    state       CircuitState
+    consecutive int
+    openedAt    time.Time
+    probes      int // 半开状态下正在进行的探测请求数
+    successes   int // 半开状态下成功的探测请求数
+    buckets     [breakerBuckets]bucket
+}
+
+type bucket struct {
+    start    time.Time
+    total    int
+    failures int
+}
+
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+    if cfg.MinRequests <= 0 {
+        cfg.MinRequests = 10
+    }
+    if cfg.Window <= 0 {
+        cfg.Window = 10 * time.Second
+    }
+    // 窗口分成 breakerBuckets 个桶，每个桶至少 1ms
+    if cfg.Window < breakerBuckets*time.Millisecond {
+        cfg.Window = breakerBuckets * time.Millisecond
+    }
+    if cfg.OpenTimeout <= 0 {
+        cfg.OpenTimeout = 30 * time.Second
+    }
+    if cfg.HalfOpenRequests <= 0 {
+        cfg.HalfOpenRequests = 1
+    }
+    if cfg.IsFailure == nil {
+        cfg.IsFailure = defaultIsFailure
+    }
+    return &CircuitBreaker{
+        cfg:   cfg,
+        hosts: make(map[string]*circuit),
+    }
+}
+
+func defaultIsFailure(resp *http.Response, err error) bool {
+    if err != nil {
+        return true
+    }
+    return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// State returns the current state of the host circuit.
+func (b *CircuitBreaker) State(host string) CircuitState {
+    b.mu.Lock()
+    c := b.circuit(host)
+    from := c.state
+    to := b.refresh(c, time.Now())
+    b.mu.Unlock()
+    b.notify(host, from, to)
+    return to
+}
+
+// Allow reports whether a request to host may be sent, it returns a *CircuitOpenError otherwise.
+// Every allowed request must be followed by Record.
+func (b *CircuitBreaker) Allow(host string) error {
+    b.mu.Lock()
+    c := b.circuit(host)
+    from := c.state
+    to := b.refresh(c, time.Now())
+    var err error
+    switch to {
+    case StateOpen:
+        err = &CircuitOpenError{Host: host, State: to}
+    case StateHalfOpen:
+        if c.probes+c.successes >= b.cfg.HalfOpenRequests {
+            err = &CircuitOpenError{Host: host, State: to}
+        } else {
+            c.probes++
+        }
+    }
+    b.mu.Unlock()
+    b.notify(host, from, to)
+    return err
+}
+
+// Record reports the result of a request allowed by Allow.
+func (b *CircuitBreaker) Record(host string, resp *http.Response, err error) {
+    // 调用方主动取消以及被客户端限流的请求不计入统计
+    canceled := errors.Is(err, context.Canceled) || errors.Is(err, ErrRateLimited)
+    failure := !canceled && b.cfg.IsFailure(resp, err)
+    now := time.Now()
+
+    b.mu.Lock()
+    c := b.circuit(host)
+    from := c.state
+    switch c.state {
+    case StateHalfOpen:
+        if c.probes > 0 {
+            c.probes--
+        }
+        if canceled {
+            break
+        }
+        if failure {
+            b.trip(c, now)
+        } else if c.successes++; c.successes >= b.cfg.HalfOpenRequests {
+            b.reset(c)
+        }
+    case StateClosed:
+        if canceled {
+            break
+        }
+        bk := c.bucket(now, b.cfg.Window)
+        bk.total++
+        if failure {
+            bk.failures++
+            c.consecutive++
+        } else {
+            c.consecutive = 0
+        }
+        if b.shouldTrip(c, now) {
+            b.trip(c, now)
+        }
+    }
+    to := c.state
+    b.mu.Unlock()
+    b.notify(host, from, to)
+}
+
+func (b *CircuitBreaker) circuit(host string) *circuit {
+    c, ok := b.hosts[host]
+    if !ok {
+        c = &circuit{}
+        b.hosts[host] = c
+    }
+    return c
+}
+
+// refresh moves an open circuit to half-open once OpenTimeout elapsed.
+func (b *CircuitBreaker) refresh(c *circuit, now time.Time) CircuitState {
+    if c.state == StateOpen && now.Sub(c.openedAt) >= b.cfg.OpenTimeout {
+        c.state = StateHalfOpen
+        c.probes = 0
+        c.successes = 0
+    }
+    return c.state
+}
+
+func (b *CircuitBreaker) shouldTrip(c *circuit, now time.Time) bool {
+    if b.cfg.ConsecutiveFailures > 0 && c.consecutive >= b.cfg.ConsecutiveFailures {
+        return true
+    }
+    if b.cfg.FailureRate <= 0 {
+        return false
+    }
+    total, failures := c.count(now, b.cfg.Window)
+    return total >= b.cfg.MinRequests && float64(failures)/float64(total) >= b.cfg.FailureRate
+}
+
+func (b *CircuitBreaker) trip(c *circuit, now time.Time) {
+    c.state = StateOpen
+    c.openedAt = now
+    c.probes = 0
+    c.successes = 0
+}
+
+func (b *CircuitBreaker) reset(c *circuit) {
+    *c = circuit{}
+}
+
+func (b *CircuitBreaker) notify(host string, from, to CircuitState) {
+    if from != to && b.cfg.OnStateChange != nil {
+        b.cfg.OnStateChange(host, from, to)
+    }
+}
+
+// bucket returns the bucket of the sliding window that now falls into.
+func (c *circuit) bucket(now time.Time, window time.Duration) *bucket {
+    size := window / breakerBuckets
+    start := now.Truncate(size)
+    bk := &c.buckets[(start.UnixNano()/int64(size))%breakerBuckets]
+    if !bk.start.Equal(start) {
+        *bk = bucket{start: start}
+    }
+    return bk
+}
+
+// count sums the buckets still inside the sliding window.
+func (c *circuit) count(now time.Time, window time.Duration) (total, failures int) {
+    for _, bk := range c.buckets {
+        if now.Sub(bk.start) < window {
+            total += bk.total
+            failures += bk.failures
+        }
+    }
+    return total, failures
+}
@@ -0,0 +1,144 @@
+package http
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+var (
+    ok200   = &http.Response{StatusCode: http.StatusOK}
+    fail500 = &http.Response{StatusCode: http.StatusInternalServerError}
+)
+
+// stateRecorder collects the state changes of a breaker.
+type stateRecorder struct {
+    mu      sync.Mutex
+    changes []string
+}
+
+func (r *stateRecorder) record(host string, from, to CircuitState) {
+    r.mu.Lock()
+    r.changes = append(r.changes, fmt.Sprintf("%s %s->%s", host, from, to))
+    r.mu.Unlock()
+}
+
+func (r *stateRecorder) String() string {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return fmt.Sprint(r.changes)
+}
+
+// breakerSend runs one request to host through b, it fails when Allow rejects it.
+func breakerSend(t *testing.T, b *CircuitBreaker, host string, resp *http.Response, err error) {
+    t.Helper()
+    if er := b.Allow(host); er != nil {
+        t.Fatalf("request rejected: %v", er)
+    }
+    b.Record(host, resp, err)
+}
+
+func TestCircuitBreakerStates(t *testing.T) {
+    rec := &stateRecorder{}
+    b := NewCircuitBreaker(BreakerConfig{
+        ConsecutiveFailures: 3,
+        OpenTimeout:         50 * time.Millisecond,
+        OnStateChange:       rec.record,
+    })
+    breakerSend(t, b, "a", fail500, nil)
+    breakerSend(t, b, "a", fail500, nil)
+    breakerSend(t, b, "a", ok200, nil)
+    // 成功的请求清零连续失败次数
+    breakerSend(t, b, "a", fail500, nil)
+    breakerSend(t, b, "a", nil, errors.New("connection refused"))
+    if s := b.State("a"); s != StateClosed {
+        t.Fatalf("state = %s", s)
+    }
+    breakerSend(t, b, "a", fail500, nil)
+    err := b.Allow("a")
+    var coe *CircuitOpenError
+    if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &coe) || coe.Host != "a" || coe.State != StateOpen {
+        t.Fatalf("Allow() = %v", err)
+    }
+    // 其他 host 不受影响
+    breakerSend(t, b, "b", ok200, nil)
+
+    time.Sleep(60 * time.Millisecond)
+    if err := b.Allow("a"); err != nil {
+        t.Fatalf("probe rejected: %v", err)
+    }
+    // 半开状态下只允许一个探测请求
+    if err := b.Allow("a"); !errors.Is(err, ErrCircuitOpen) {
+        t.Fatalf("second probe allowed: %v", err)
+    }
+    b.Record("a", fail500, nil)
+    if s := b.State("a"); s != StateOpen {
+        t.Fatalf("state after a failed probe = %s", s)
+    }
+
+    time.Sleep(60 * time.Millisecond)
+    breakerSend(t, b, "a", ok200, nil)
+    if s := b.State("a"); s != StateClosed {
+        t.Fatalf("state after a successful probe = %s", s)
+    }
+    want := "[a closed->open a open->half-open a half-open->open a open->half-open a half-open->closed]"
+    if got := rec.String(); got != want {
+        t.Fatalf("state changes %s, want %s", got, want)
+    }
+}
+
+func TestCircuitBreakerFailureRate(t *testing.T) {
+    b := NewCircuitBreaker(BreakerConfig{FailureRate: 0.5, MinRequests: 4})
+    breakerSend(t, b, "a", fail500, nil)
+    breakerSend(t, b, "a", fail500, nil)
+    breakerSend(t, b, "a", ok200, nil)
+    if s := b.State("a"); s != StateClosed {
+        t.Fatalf("tripped below MinRequests: %s", s)
+    }
+    // 取消和客户端限流不计入统计
+    breakerSend(t, b, "a", nil, context.Canceled)
+    breakerSend(t, b, "a", nil, &RateLimitError{Limit: "global"})
+    if s := b.State("a"); s != StateClosed {
+        t.Fatalf("canceled requests counted: %s", s)
+    }
+    breakerSend(t, b, "a", ok200, nil)
+    if s := b.State("a"); s != StateOpen {
+        t.Fatalf("2 failures of 4 requests: %s", s)
+    }
+}
+
+func TestCircuitBreakerTinyWindow(t *testing.T) {
+    b := NewCircuitBreaker(BreakerConfig{FailureRate: 1, MinRequests: 2, Window: time.Nanosecond})
+    breakerSend(t, b, "a", fail500, nil)
+    breakerSend(t, b, "a", fail500, nil)
+    if s := b.State("a"); s != StateOpen {
+        t.Fatalf("state = %s", s)
+    }
+}
+
+func TestCircuitBreakerClient(t *testing.T) {
+    var requests int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(&requests, 1)
+        w.WriteHeader(http.StatusBadGateway)
+    }))
+    defer srv.Close()
+
+    b := NewCircuitBreaker(BreakerConfig{ConsecutiveFailures: 2})
+    for i := 0; i < 4; i++ {
+        h, _ := Get(srv.URL)
+        _, err := h.SetCircuitBreaker(b).Response()
+        if i >= 2 && !errors.Is(err, ErrCircuitOpen) {
+            t.Fatalf("request %d: %v", i, err)
+        }
+    }
+    if n := atomic.LoadInt32(&requests); n != 2 {
+        t.Fatalf("server got %d requests, want 2", n)
+    }
+}
@@ -0,0 +1,551 @@
+package http
+
+import (
+    "bytes"
+    "container/list"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Cache stores the serialized responses of the response cache, it must be safe for concurrent use.
+type Cache interface {
+    Get(key string) ([]byte, bool)
+    Set(key string, value []byte)
+    Delete(key string)
+}
+
+// maxCacheEntry is the largest response body stored by the response cache.
+const maxCacheEntry = 32 << 20
+
+// SetCache turns on the RFC 7234 private cache for GET requests: fresh responses are served from store,
+// stale ones are revalidated with If-None-Match and If-Modified-Since, and a 304 is answered with the stored body.
+// Responses served from the cache carry the header X-From-Cache: 1. nil turns the cache off.
+// Responses to authenticated requests are only cached when they are Cache-Control: public.
+func (h *HttpClient) SetCache(store Cache) *HttpClient {
+    h.cache = store
+
+    return h
+}
+
+// FromCache reports whether resp was served from the response cache.
+func FromCache(resp *http.Response) bool {
+    return resp != nil && resp.Header.Get("X-From-Cache") == "1"
+}
+
+type cacheEntry struct {
+    StatusCode   int
+    Status       string
+    Header       http.Header
+    Body         []byte
+    Vary         map[string]string // Vary 中列出的请求头在存储时的值
+    RequestTime  time.Time
+    ResponseTime time.Time
+}
+
+// defaultRevalidateTimeout bounds a background revalidation when the client has no per-attempt timeout.
+const defaultRevalidateTimeout = 30 * time.Second
+
+// revalidating holds the keys being revalidated in the background by stale-while-revalidate.
+var revalidating sync.Map
+
+func cacheInterceptor(store Cache) Interceptor {
+    return func(next Doer) Doer {
+        return DoerFunc(func(req *http.Request) (*http.Response, error) {
+            key := req.URL.String()
+            if req.Method != http.MethodGet && req.Method != http.MethodHead {
+                resp, err := next.Do(req)
+                // 非安全方法成功后使缓存失效
+                if err == nil && resp.StatusCode < 400 {
+                    store.Delete(key)
+                }
+                return resp, err
+            }
+            reqCC := parseCacheControl(req.Header)
+            if req.Method != http.MethodGet || req.Header.Get("Range") != "" || reqCC.has("no-store") {
+                return next.Do(req)
+            }
+
+            entry := loadEntry(store, key, req)
+            if entry != nil && privateResponse(req, entry.Header) {
+                entry = nil
+            }
+            if entry == nil {
+                if reqCC.has("only-if-cached") {
+                    return gatewayTimeout(req), nil
+                }
+                return fetchAndStore(next, store, key, req)
+            }
+
+            now := time.Now()
+            respCC := parseCacheControl(entry.Header)
+            age, lifetime := entry.age(now), entry.lifetime(respCC)
+            if v, ok := reqCC.seconds("max-age"); ok && age > v {
+                lifetime = v
+            }
+            fresh := lifetime - age
+            if v, ok := reqCC.seconds("min-fresh"); ok {
+                fresh -= v
+            }
+            mustRevalidate := respCC.has("must-revalidate") || respCC.has("no-cache")
+            if !mustRevalidate && fresh <= 0 {
+                if v, ok := reqCC.seconds("max-stale"); ok && (reqCC["max-stale"] == "" || -fresh <= v) {
+                    fresh = 1
+                }
+            }
+            if fresh > 0 && !reqCC.has("no-cache") && !respCC.has("no-cache") {
+                return entry.response(req), nil
+            }
+            if reqCC.has("only-if-cached") {
+                return gatewayTimeout(req), nil
+            }
+            if swr, ok := respCC.seconds("stale-while-revalidate"); ok && !mustRevalidate && !reqCC.has("no-cache") && -fresh <= swr {
+                if _, busy := revalidating.LoadOrStore(key, true); !busy {
+                    // 后台刷新不随请求取消，但要有超时，否则挂起的刷新会让这个 key 再也不能刷新
+                    timeout := defaultRevalidateTimeout
+                    if h := ClientFromContext(req.Context()); h != nil && h.timeout > 0 {
+                        timeout = h.timeout
+                    }
+                    ctx, cancel := context.WithTimeout(detachedContext{req.Context()}, timeout)
+                    bg := req.Clone(ctx)
+                    go func() {
+                        defer revalidating.Delete(key)
+                        defer cancel()
+                        if resp, err := revalidate(next, store, key, bg, entry); err == nil {
+                            drainBody(resp.Body)
+                        }
+                    }()
+                }
+                return entry.response(req), nil
+            }
+            return revalidate(next, store, key, req, entry)
+        })
+    }
+}
+
+// revalidate sends req conditionally on the validators of entry, a 304 refreshes entry and returns its body.
+func revalidate(next Doer, store Cache, key string, req *http.Request, entry *cacheEntry) (*http.Response, error) {
+    etag, lastModified := entry.Header.Get("ETag"), entry.Header.Get("Last-Modified")
+    if etag == "" && lastModified == "" {
+        return fetchAndStore(next, store, key, req)
+    }
+    conditional := req.Clone(req.Context())
+    if etag != "" {
+        conditional.Header.Set("If-None-Match", etag)
+    }
+    if lastModified != "" {
+        conditional.Header.Set("If-Modified-Since", lastModified)
+    }
+    requestTime := time.Now()
+    resp, err := next.Do(conditional)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode != http.StatusNotModified {
+        return storeResponse(store, key, req, resp, requestTime), nil
+    }
+    drainBody(resp.Body)
+    for k, v := range resp.Header {
+        // 304 不携带实体相关的头，其余的头更新到缓存中
+        switch k {
+        case "Content-Length", "Content-Encoding", "Content-Type", "Transfer-Encoding":
+            continue
+        }
+        entry.Header[k] = v
+    }
+    entry.RequestTime, entry.ResponseTime = requestTime, time.Now()
+    saveEntry(store, key, entry)
+    return entry.response(req), nil
+}
+
+func fetchAndStore(next Doer, store Cache, key string, req *http.Request) (*http.Response, error) {
+    requestTime := time.Now()
+    resp, err := next.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    return storeResponse(store, key, req, resp, requestTime), nil
+}
+
+// storeResponse tees the body of a cacheable response into the cache, the entry is saved
+// once the body has been read to the end.
+func storeResponse(store Cache, key string, req *http.Request, resp *http.Response, requestTime time.Time) *http.Response {
+    if privateResponse(req, resp.Header) {
+        return resp
+    }
+    if !cacheable(req, resp) {
+        if resp.StatusCode < 500 {
+            store.Delete(key)
+        }
+        return resp
+    }
+    entry := &cacheEntry{
+        StatusCode:   resp.StatusCode,
+        Status:       resp.Status,
+        Header:       resp.Header.Clone(),
+        Vary:         make(map[string]string),
+        RequestTime:  requestTime,
+        ResponseTime: time.Now(),
+    }
+    for _, name := range varyHeaders(resp.Header) {
+        entry.Vary[name] = req.Header.Get(name)
+    }
+    resp.Body = &cacheBody{ReadCloser: resp.Body, store: store, key: key, entry: entry}
+    return resp
+}
+
+type cacheBody struct {
+    io.ReadCloser
+    store Cache
+    key   string
+    entry *cacheEntry
+    buf   bytes.Buffer
+    done  bool
+}
+
+func (b *cacheBody) Read(p []byte) (int, error) {
+    n, err := b.ReadCloser.Read(p)
+    if !b.done {
+        b.buf.Write(p[:n])
+        if b.buf.Len() > maxCacheEntry {
+            b.done = true
+            b.buf = bytes.Buffer{}
+        }
+        if err == io.EOF {
+            b.done = true
+            b.entry.Body = b.buf.Bytes()
+            saveEntry(b.store, b.key, b.entry)
+        }
+    }
+    return n, err
+}
+
+func cacheable(req *http.Request, resp *http.Response) bool {
+    switch resp.StatusCode {
+    case 200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501:
+    default:
+        return false
+    }
+    respCC := parseCacheControl(resp.Header)
+    if respCC.has("no-store") || parseCacheControl(req.Header).has("no-store") {
+        return false
+    }
+    if resp.Header.Get("Vary") == "*" {
+        return false
+    }
+    _, maxAge := respCC.seconds("max-age")
+    return maxAge || resp.Header.Get("Expires") != "" || resp.Header.Get("ETag") != "" ||
+        resp.Header.Get("Last-Modified") != ""
+}
+
+// privateResponse reports whether a response with header must not be shared: the cache runs before the
+// Authenticator and its key does not include the credentials, so the response to an authenticated
+// request is only stored and served when it is public and does not vary by Authorization.
+func privateResponse(req *http.Request, header http.Header) bool {
+    if req.Header.Get("Authorization") == "" {
+        if h := ClientFromContext(req.Context()); h == nil || h.auth == nil {
+            return false
+        }
+    }
+    if !parseCacheControl(header).has("public") {
+        return true
+    }
+    for _, name := range varyHeaders(header) {
+        if name == "Authorization" {
+            return true
+        }
+    }
+    return false
+}
+
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+    header := e.Header.Clone()
+    header.Set("X-From-Cache", "1")
+    return &http.Response{
+        Status:        e.Status,
+        StatusCode:    e.StatusCode,
+        Proto:         "HTTP/1.1",
+        ProtoMajor:    1,
+        ProtoMinor:    1,
+        Header:        header,
+        Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+        ContentLength: int64(len(e.Body)),
+        Request:       req,
+    }
+}
+
+// age is the current age of the entry as defined by RFC 7234 section 4.2.3.
+func (e *cacheEntry) age(now time.Time) time.Duration {
+    date := e.date()
+    apparent := e.ResponseTime.Sub(date)
+    if apparent < 0 {
+        apparent = 0
+    }
+    corrected := e.ResponseTime.Sub(e.RequestTime)
+    if v, err := strconv.Atoi(e.Header.Get("Age")); err == nil {
+        corrected += time.Duration(v) * time.Second
+    }
+    if apparent > corrected {
+        corrected = apparent
+    }
+    return corrected + now.Sub(e.ResponseTime)
+}
+
+// lifetime is the freshness lifetime: max-age, Expires minus Date, or 10% of the time since Last-Modified.
+func (e *cacheEntry) lifetime(cc cacheControl) time.Duration {
+    if v, ok := cc.seconds("max-age"); ok {
+        return v
+    }
+    if expires := e.Header.Get("Expires"); expires != "" {
+        t, err := http.ParseTime(expires)
+        if err != nil {
+            return 0
+        }
+        return t.Sub(e.date())
+    }
+    if lm, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil {
+        switch e.StatusCode {
+        case 200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501:
+            lifetime := e.date().Sub(lm) / 10
+            if lifetime > 24*time.Hour {
+                lifetime = 24 * time.Hour
+            }
+            return lifetime
+        }
+    }
+    return 0
+}
+
+func (e *cacheEntry) date() time.Time {
+    if t, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+        return t
+    }
+    return e.ResponseTime
+}
+
+func loadEntry(store Cache, key string, req *http.Request) *cacheEntry {
+    data, ok := store.Get(key)
+    if !ok {
+        return nil
+    }
+    entry := &cacheEntry{}
+    if err := json.Unmarshal(data, entry); err != nil {
+        store.Delete(key)
+        return nil
+    }
+    // 只保存一个变体，Vary 的请求头不一致时视为未命中
+    for name, value := range entry.Vary {
+        if req.Header.Get(name) != value {
+            return nil
+        }
+    }
+    return entry
+}
+
+func saveEntry(store Cache, key string, entry *cacheEntry) {
+    if data, err := json.Marshal(entry); err == nil {
+        store.Set(key, data)
+    }
+}
+
+func varyHeaders(header http.Header) []string {
+    var names []string
+    for _, v := range header.Values("Vary") {
+        for _, name := range strings.Split(v, ",") {
+            if name = strings.TrimSpace(name); name != "" {
+                names = append(names, http.CanonicalHeaderKey(name))
+            }
+        }
+    }
+    return names
+}
+
+func gatewayTimeout(req *http.Request) *http.Response {
+    return &http.Response{
+        Status:     "504 Gateway Timeout",
+        StatusCode: http.StatusGatewayTimeout,
+        Proto:      "HTTP/1.1",
+        ProtoMajor: 1,
+        ProtoMinor: 1,
+        Header:     make(http.Header),
+        Body:       http.NoBody,
+        Request:    req,
+    }
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+    cc := make(cacheControl)
+    for _, v := range header.Values("Cache-Control") {
+        for _, directive := range strings.Split(v, ",") {
+            directive = strings.TrimSpace(directive)
+            if directive == "" {
+                continue
+            }
+            name, value := directive, ""
+            if i := strings.IndexByte(directive, '='); i >= 0 {
+                name, value = directive[:i], strings.Trim(directive[i+1:], `"`)
+            }
+            cc[strings.ToLower(name)] = value
+        }
+    }
+    return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+    _, ok := cc[name]
+    return ok
+}
+
+// seconds returns the delta-seconds value of the directive, a directive without value gives 0.
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+    value, ok := cc[name]
+    if !ok {
+        return 0, false
+    }
+    if value == "" {
+        return 0, true
+    }
+    v, err := strconv.ParseInt(value, 10, 64)
+    if err != nil || v < 0 {
+        return 0, false
+    }
+    return time.Duration(v) * time.Second, true
+}
+
+// detachedContext keeps the values of its parent but is never cancelled,
+// background revalidation uses it to outlive the request that triggered it.
+type detachedContext struct {
+    parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+    return c.parent.Value(key)
+}
+
+// MemoryCache is an in-memory LRU cache bounded by the total size of its values.
+type MemoryCache struct {
+    mu       sync.Mutex
+    maxBytes int64
+    size     int64
+    ll       *list.List
+    items    map[string]*list.Element
+}
+
+type memoryItem struct {
+    key   string
+    value []byte
+}
+
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+    return &MemoryCache{
+        maxBytes: maxBytes,
+        ll:       list.New(),
+        items:    make(map[string]*list.Element),
+    }
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    el, ok := c.items[key]
+    if !ok {
+        return nil, false
+    }
+    c.ll.MoveToFront(el)
+    return el.Value.(*memoryItem).value, true
+}
+
+func (c *MemoryCache) Set(key string, value []byte) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if int64(len(value)) > c.maxBytes {
+        c.remove(key)
+        return
+    }
+    if el, ok := c.items[key]; ok {
+        item := el.Value.(*memoryItem)
+        c.size += int64(len(value) - len(item.value))
+        item.value = value
+        c.ll.MoveToFront(el)
+    } else {
+        c.items[key] = c.ll.PushFront(&memoryItem{key: key, value: value})
+        c.size += int64(len(value))
+    }
+    for c.size > c.maxBytes {
+        c.remove(c.ll.Back().Value.(*memoryItem).key)
+    }
+}
+
+func (c *MemoryCache) Delete(key string) {
+    c.mu.Lock()
+    c.remove(key)
+    c.mu.Unlock()
+}
+
+func (c *MemoryCache) remove(key string) {
+    if el, ok := c.items[key]; ok {
+        c.ll.Remove(el)
+        delete(c.items, key)
+        c.size -= int64(len(el.Value.(*memoryItem).value))
+    }
+}
+
+// DiskCache stores every value in a file of dir named by the SHA-256 of its key.
+type DiskCache struct {
+    dir string
+}
+
+func NewDiskCache(dir string) (*DiskCache, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, err
+    }
+    return &DiskCache{dir: dir}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+    sum := sha256.Sum256([]byte(key))
+    return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+    data, err := ioutil.ReadFile(c.path(key))
+    return data, err == nil
+}
+
+// Set writes a temp file and renames it, so that readers never see a partial value.
+func (c *DiskCache) Set(key string, value []byte) {
+    f, err := ioutil.TempFile(c.dir, ".tmp-")
+    if err != nil {
+        return
+    }
+    _, err = f.Write(value)
+    if er := f.Close(); err == nil {
+        err = er
+    }
+    if err == nil {
+        err = os.Rename(f.Name(), c.path(key))
+    }
+    if err != nil {
+        os.Remove(f.Name())
+    }
+}
+
+func (c *DiskCache) Delete(key string) {
+    os.Remove(c.path(key))
+}
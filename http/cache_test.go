@@ -0,0 +1,200 @@
+package http
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// cachedGet sends a GET through store and returns the body and whether it came from the cache.
+func cachedGet(t *testing.T, store Cache, url string, setup ...func(h *HttpClient)) (string, bool) {
+    t.Helper()
+    h, _ := Get(url)
+    h.SetCache(store)
+    for _, fn := range setup {
+        fn(h)
+    }
+    resp, err := h.Response()
+    if err != nil {
+        t.Fatal(err)
+    }
+    body, err := h.Bytes()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return string(body), FromCache(resp)
+}
+
+func TestCacheAuthenticated(t *testing.T) {
+    var requests int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(&requests, 1)
+        switch r.URL.Path {
+        case "/private":
+            w.Header().Set("Cache-Control", "max-age=60")
+        case "/public":
+            w.Header().Set("Cache-Control", "public, max-age=60")
+        }
+        w.Write([]byte("hello " + r.Header.Get("Authorization")))
+    }))
+    defer srv.Close()
+
+    store := NewMemoryCache(1 << 20)
+    as := func(token string) func(h *HttpClient) {
+        return func(h *HttpClient) { h.SetAuth(NewBearerAuth(token)) }
+    }
+    for _, tt := range []struct {
+        token, want string
+    }{{"a", "hello Bearer a"}, {"b", "hello Bearer b"}, {"a", "hello Bearer a"}} {
+        if body, cached := cachedGet(t, store, srv.URL+"/private", as(tt.token)); body != tt.want || cached {
+            t.Fatalf("user %s got %q, from cache %v", tt.token, body, cached)
+        }
+    }
+    // 没有认证的请求也不会拿到认证请求的响应
+    if body, _ := cachedGet(t, store, srv.URL+"/private"); body != "hello " {
+        t.Fatalf("anonymous request got %q", body)
+    }
+
+    atomic.StoreInt32(&requests, 0)
+    cachedGet(t, store, srv.URL+"/public", as("a"))
+    if _, cached := cachedGet(t, store, srv.URL+"/public", as("b")); !cached || atomic.LoadInt32(&requests) != 1 {
+        t.Fatalf("public response not shared, %d requests", requests)
+    }
+}
+
+func TestCacheFreshness(t *testing.T) {
+    var requests int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        n := atomic.AddInt32(&requests, 1)
+        w.Header().Set("Cache-Control", "max-age=60")
+        w.Write([]byte{byte('0' + n)})
+    }))
+    defer srv.Close()
+
+    store := NewMemoryCache(1 << 20)
+    if body, cached := cachedGet(t, store, srv.URL); body != "1" || cached {
+        t.Fatalf("first request got %q, from cache %v", body, cached)
+    }
+    if body, cached := cachedGet(t, store, srv.URL); body != "1" || !cached {
+        t.Fatalf("fresh response got %q, from cache %v", body, cached)
+    }
+    // 请求的 no-cache 跳过新鲜的缓存
+    noCache := func(h *HttpClient) { h.Header("Cache-Control", "no-cache") }
+    if body, cached := cachedGet(t, store, srv.URL, noCache); body != "2" || cached {
+        t.Fatalf("no-cache request got %q, from cache %v", body, cached)
+    }
+}
+
+func TestCacheRevalidate(t *testing.T) {
+    var requests, notModified int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(&requests, 1)
+        w.Header().Set("Cache-Control", "max-age=0")
+        w.Header().Set("ETag", `"v1"`)
+        if r.Header.Get("If-None-Match") == `"v1"` {
+            atomic.AddInt32(&notModified, 1)
+            w.Header().Set("X-Checked", "yes")
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+        w.Write([]byte("body v1"))
+    }))
+    defer srv.Close()
+
+    store := NewMemoryCache(1 << 20)
+    cachedGet(t, store, srv.URL)
+    h, _ := Get(srv.URL)
+    resp, err := h.SetCache(store).Response()
+    if err != nil {
+        t.Fatal(err)
+    }
+    body, _ := h.Bytes()
+    if string(body) != "body v1" || !FromCache(resp) || resp.StatusCode != http.StatusOK || resp.Header.Get("X-Checked") != "yes" {
+        t.Fatalf("got %d %q, header %v", resp.StatusCode, body, resp.Header)
+    }
+    if atomic.LoadInt32(&requests) != 2 || atomic.LoadInt32(&notModified) != 1 {
+        t.Fatalf("%d requests, %d not modified", requests, notModified)
+    }
+}
+
+func TestCacheVary(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Cache-Control", "max-age=60")
+        w.Header().Set("Vary", "Accept-Language")
+        w.Write([]byte("hello " + r.Header.Get("Accept-Language")))
+    }))
+    defer srv.Close()
+
+    store := NewMemoryCache(1 << 20)
+    lang := func(l string) func(h *HttpClient) {
+        return func(h *HttpClient) { h.Header("Accept-Language", l) }
+    }
+    cachedGet(t, store, srv.URL, lang("en"))
+    if body, cached := cachedGet(t, store, srv.URL, lang("en")); body != "hello en" || !cached {
+        t.Fatalf("same variant got %q, from cache %v", body, cached)
+    }
+    if body, cached := cachedGet(t, store, srv.URL, lang("fr")); body != "hello fr" || cached {
+        t.Fatalf("other variant got %q, from cache %v", body, cached)
+    }
+}
+
+func TestCacheNoStore(t *testing.T) {
+    var requests int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(&requests, 1)
+        if r.URL.Path == "/secret" {
+            w.Header().Set("Cache-Control", "no-store, max-age=60")
+        } else {
+            w.Header().Set("Cache-Control", "max-age=60")
+        }
+    }))
+    defer srv.Close()
+
+    store := NewMemoryCache(1 << 20)
+    cachedGet(t, store, srv.URL+"/secret")
+    if _, cached := cachedGet(t, store, srv.URL+"/secret"); cached {
+        t.Fatal("no-store response served from cache")
+    }
+    noStore := func(h *HttpClient) { h.Header("Cache-Control", "no-store") }
+    cachedGet(t, store, srv.URL+"/open", noStore)
+    if _, cached := cachedGet(t, store, srv.URL+"/open"); cached {
+        t.Fatal("response to a no-store request was stored")
+    }
+    if n := atomic.LoadInt32(&requests); n != 4 {
+        t.Fatalf("server got %d requests, want 4", n)
+    }
+}
+
+func TestCacheStaleWhileRevalidateTimeout(t *testing.T) {
+    var requests int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        // 除了第一个请求，后台刷新都挂起
+        if atomic.AddInt32(&requests, 1) > 1 {
+            select {
+            case <-r.Context().Done():
+            case <-time.After(5 * time.Second):
+            }
+            return
+        }
+        w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+        w.Header().Set("ETag", `"v1"`)
+        w.Write([]byte("stale"))
+    }))
+    defer srv.Close()
+
+    store := NewMemoryCache(1 << 20)
+    timeout := func(h *HttpClient) { h.SetTimeout(50 * time.Millisecond) }
+    cachedGet(t, store, srv.URL, timeout)
+    for i := 0; i < 2; i++ {
+        if body, cached := cachedGet(t, store, srv.URL, timeout); body != "stale" || !cached {
+            t.Fatalf("got %q, from cache %v", body, cached)
+        }
+        time.Sleep(200 * time.Millisecond)
+    }
+    // 超时的后台刷新结束后，下一次请求重新触发刷新
+    if n := atomic.LoadInt32(&requests); n != 3 {
+        t.Fatalf("server got %d requests, want 3", n)
+    }
+}
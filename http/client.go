@@ -0,0 +1,389 @@
+package http
+
+import (
+    "context"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/uber/jaeger-lib/metrics"
+)
+
+// Client is a long-lived client holding the settings shared by all its requests: base URL, default headers,
+// user agent, retry policy, cookie jar and transport. It is safe for concurrent use and hands out cheap
+// per-call builders, which keeps the connections of the transport reused.
+//     client := uHttp.NewClient("https://api.example.com", nil).SetHeader("Accept", "application/json")
+//     req, err := client.R().SetPathParam("id", "42").Get("/users/{id}")
+//     err = req.ToJSON(&user)
+type Client struct {
+    mu            sync.RWMutex
+    baseURL       string
+    header        http.Header
+    userAgent     string
+    retryPolicy   RetryPolicy
+    breaker       *CircuitBreaker
+    interceptors  []Interceptor
+    timeout       time.Duration
+    logging       *LogConfig
+    errorOnStatus bool
+    gzip          bool
+    bandwidth     *BandwidthLimiter
+    auth          Authenticator
+    signing       *SignConfig
+    cache         Cache
+    rateLimiter   *RateLimiter
+    metrics       *requestMetrics
+    httpClient    *http.Client
+
+    // HttpClient.SetProxy 使用的 http.Client，由 proxyBase 包装一个 ProxyTransport 得到
+    proxyMu     sync.Mutex
+    proxyBase   *http.Client
+    proxyClient *http.Client
+}
+
+// NewClient creates a client for baseURL, trans nil uses http.DefaultTransport.
+func NewClient(baseURL string, trans http.RoundTripper) *Client {
+    if trans == nil {
+        trans = http.DefaultTransport
+    }
+    return &Client{
+        baseURL:    baseURL,
+        header:     make(http.Header),
+        httpClient: &http.Client{Transport: trans},
+    }
+}
+
+func (c *Client) SetBaseURL(baseURL string) *Client {
+    c.mu.Lock()
+    c.baseURL = baseURL
+    c.mu.Unlock()
+
+    return c
+}
+
+// SetHeader sets a header sent with every request, a request can still override it.
+func (c *Client) SetHeader(key, value string) *Client {
+    c.mu.Lock()
+    c.header.Set(key, value)
+    c.mu.Unlock()
+
+    return c
+}
+
+func (c *Client) SetUserAgent(ua string) *Client {
+    c.mu.Lock()
+    c.userAgent = ua
+    c.mu.Unlock()
+
+    return c
+}
+
+func (c *Client) SetRetryPolicy(policy RetryPolicy) *Client {
+    c.mu.Lock()
+    c.retryPolicy = policy
+    c.mu.Unlock()
+
+    return c
+}
+
+func (c *Client) SetCircuitBreaker(breaker *CircuitBreaker) *Client {
+    c.mu.Lock()
+    c.breaker = breaker
+    c.mu.Unlock()
+
+    return c
+}
+
+// SetTimeout sets the per-attempt timeout of every request.
+func (c *Client) SetTimeout(timeout time.Duration) *Client {
+    c.mu.Lock()
+    c.timeout = timeout
+    c.mu.Unlock()
+
+    return c
+}
+
+// Use appends interceptors run by every request before the interceptors of the request itself.
+func (c *Client) Use(interceptors ...Interceptor) *Client {
+    c.mu.Lock()
+    c.interceptors = append(c.interceptors, interceptors...)
+    c.mu.Unlock()
+
+    return c
+}
+
+func (c *Client) SetLogging(cfg *LogConfig) *Client {
+    c.mu.Lock()
+    c.logging = cfg
+    c.mu.Unlock()
+
+    return c
+}
+
+func (c *Client) SetErrorOnStatus(on bool) *Client {
+    c.mu.Lock()
+    c.errorOnStatus = on
+    c.mu.Unlock()
+
+    return c
+}
+
+func (c *Client) SetGzipOn(on bool) *Client {
+    c.mu.Lock()
+    c.gzip = on
+    c.mu.Unlock()
+
+    return c
+}
+
+// SetBandwidthLimiter caps the total speed of all requests of the client.
+func (c *Client) SetBandwidthLimiter(limiter *BandwidthLimiter) *Client {
+    c.mu.Lock()
+    c.bandwidth = limiter
+    c.mu.Unlock()
+
+    return c
+}
+
+// SetAuth sets the authenticator of every request, an OAuth2 token is then shared by all of them.
+func (c *Client) SetAuth(auth Authenticator) *Client {
+    c.mu.Lock()
+    c.auth = auth
+    c.mu.Unlock()
+
+    return c
+}
+
+func (c *Client) SetSigning(cfg *SignConfig) *Client {
+    c.mu.Lock()
+    c.signing = cfg
+    c.mu.Unlock()
+
+    return c
+}
+
+// SetCache turns on the response cache of every GET request, see HttpClient.SetCache.
+func (c *Client) SetCache(store Cache) *Client {
+    c.mu.Lock()
+    c.cache = store
+    c.mu.Unlock()
+
+    return c
+}
+
+// SetRateLimiter limits the requests of the client, the limiter can also be shared by several clients.
+func (c *Client) SetRateLimiter(limiter *RateLimiter) *Client {
+    c.mu.Lock()
+    c.rateLimiter = limiter
+    c.mu.Unlock()
+
+    return c
+}
+
+// SetMetrics records the metrics of every request in f, labeled with the path template as the route.
+func (c *Client) SetMetrics(f metrics.Factory) *Client {
+    m := newRequestMetrics(f)
+    c.mu.Lock()
+    c.metrics = m
+    c.mu.Unlock()
+
+    return c
+}
+
+// SetCookieJar sets the cookie jar shared by all requests of the client.
+func (c *Client) SetCookieJar(jar http.CookieJar) *Client {
+    c.mu.Lock()
+    hc := *c.httpClient
+    hc.Jar = jar
+    c.httpClient = &hc
+    c.mu.Unlock()
+
+    return c
+}
+
+// SetProxy sends every request through proxyURL, see ProxyURL. Set the transport first,
+// SetTransport replaces the proxies.
+func (c *Client) SetProxy(proxyURL string) *Client {
+    return c.SetProxySelector(ProxyURL(proxyURL))
+}
+
+// SetProxySelector picks the proxy of every request with selector, such as a ProxyPool.
+func (c *Client) SetProxySelector(selector ProxySelector) *Client {
+    c.setProxy(func(t *ProxyTransport) {
+        t.selector = selector
+    })
+
+    return c
+}
+
+// SetNoProxy connects directly to the hosts of the NO_PROXY style list, see NoProxy.
+func (c *Client) SetNoProxy(list string) *Client {
+    c.setProxy(func(t *ProxyTransport) {
+        t.noProxy = ParseNoProxy(list)
+    })
+
+    return c
+}
+
+// setProxy replaces the transport with a ProxyTransport keeping the previous proxy settings.
+func (c *Client) setProxy(set func(t *ProxyTransport)) {
+    c.mu.Lock()
+    t := NewProxyTransport(c.httpClient.Transport, nil)
+    if old, ok := c.httpClient.Transport.(*ProxyTransport); ok {
+        t.selector, t.noProxy = old.selector, old.noProxy
+    }
+    set(t)
+    hc := *c.httpClient
+    hc.Transport = t
+    c.httpClient = &hc
+    c.mu.Unlock()
+}
+
+// SetTransport replaces the transport, requests already handed out keep the previous one.
+func (c *Client) SetTransport(trans http.RoundTripper) *Client {
+    c.mu.Lock()
+    hc := *c.httpClient
+    hc.Transport = trans
+    c.httpClient = &hc
+    c.mu.Unlock()
+
+    return c
+}
+
+// HTTPClient returns the underlying *http.Client.
+func (c *Client) HTTPClient() *http.Client {
+    c.mu.RLock()
+    defer c.mu.RUnlock()
+    return c.httpClient
+}
+
+// R returns a builder for one request.
+func (c *Client) R() *Request {
+    return &Request{
+        client:     c,
+        ctx:        context.Background(),
+        pathParams: make(map[string]string),
+    }
+}
+
+// Request builds one HttpClient from the settings of its Client.
+type Request struct {
+    client     *Client
+    ctx        context.Context
+    pathParams map[string]string
+}
+
+func (r *Request) SetContext(ctx context.Context) *Request {
+    r.ctx = ctx
+
+    return r
+}
+
+// SetPathParam fills {key} in the path with the escaped value.
+func (r *Request) SetPathParam(key, value string) *Request {
+    r.pathParams[key] = value
+
+    return r
+}
+
+func (r *Request) SetPathParams(params map[string]string) *Request {
+    for k, v := range params {
+        r.pathParams[k] = v
+    }
+
+    return r
+}
+
+func (r *Request) Get(path string) (*HttpClient, error) {
+    return r.Execute(http.MethodGet, path)
+}
+
+func (r *Request) Head(path string) (*HttpClient, error) {
+    return r.Execute(http.MethodHead, path)
+}
+
+func (r *Request) Post(path string) (*HttpClient, error) {
+    return r.Execute(http.MethodPost, path)
+}
+
+func (r *Request) Put(path string) (*HttpClient, error) {
+    return r.Execute(http.MethodPut, path)
+}
+
+func (r *Request) Patch(path string) (*HttpClient, error) {
+    return r.Execute(http.MethodPatch, path)
+}
+
+func (r *Request) Delete(path string) (*HttpClient, error) {
+    return r.Execute(http.MethodDelete, path)
+}
+
+// Execute returns the HttpClient of method and path joined to the base URL,
+// it is sent lazily by Bytes, ToJSON, Response and so on.
+func (r *Request) Execute(method, path string) (*HttpClient, error) {
+    c := r.client
+    c.mu.RLock()
+    defer c.mu.RUnlock()
+    h, err := newHttpClient(r.ctx, joinURL(c.baseURL, r.expandPath(path)), method, c.httpClient)
+    if err != nil {
+        return nil, err
+    }
+    for k, v := range c.header {
+        h.request.Header[k] = append([]string(nil), v...)
+    }
+    h.userAgent = c.userAgent
+    h.retryPolicy = c.retryPolicy
+    h.breaker = c.breaker
+    h.timeout = c.timeout
+    h.interceptors = append([]Interceptor(nil), c.interceptors...)
+    if c.logging != nil {
+        h.SetLogging(c.logging)
+    }
+    h.errorOnStatus = c.errorOnStatus
+    h.gzip = c.gzip
+    h.sharedBandwidth = c.bandwidth
+    h.auth = c.auth
+    h.signing = c.signing
+    h.cache = c.cache
+    h.rateLimiter = c.rateLimiter
+    h.metrics = c.metrics
+    h.route = path
+    hc := c.httpClient
+    h.proxyClient = func() *http.Client {
+        return c.proxyHTTPClient(hc)
+    }
+    return h, nil
+}
+
+// proxyHTTPClient returns hc with its transport wrapped in a ProxyTransport, the result is kept
+// until the http.Client of the client changes, so the requests share the connections through their proxies.
+func (c *Client) proxyHTTPClient(hc *http.Client) *http.Client {
+    c.proxyMu.Lock()
+    defer c.proxyMu.Unlock()
+    if c.proxyBase != hc {
+        proxied := *hc
+        proxied.Transport = NewProxyTransport(hc.Transport, nil)
+        c.proxyBase, c.proxyClient = hc, &proxied
+    }
+    return c.proxyClient
+}
+
+func (r *Request) expandPath(path string) string {
+    for k, v := range r.pathParams {
+        path = strings.ReplaceAll(path, "{"+k+"}", url.PathEscape(v))
+    }
+    return path
+}
+
+// joinURL joins path to base, an absolute path URL is used as it is.
+func joinURL(base, path string) string {
+    if base == "" || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+        return path
+    }
+    if path == "" {
+        return base
+    }
+    return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+}
@@ -0,0 +1,136 @@
+package http
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestClientRequests(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("X-Path", r.URL.EscapedPath())
+        w.Header().Set("X-Accept", r.Header.Get("Accept"))
+        w.Header().Set("X-Agent", r.Header.Get("User-Agent"))
+        w.Write([]byte(r.Method))
+    }))
+    defer srv.Close()
+
+    c := NewClient(srv.URL+"/api/", nil).SetHeader("Accept", "application/json").SetUserAgent("utils/1.0")
+    tests := []struct {
+        build  func() (*HttpClient, error)
+        method string
+        path   string
+        accept string
+    }{
+        {func() (*HttpClient, error) {
+            return c.R().SetPathParam("id", "a b/c").Get("/users/{id}")
+        }, "GET", "/api/users/a%20b%2Fc", "application/json"},
+        {func() (*HttpClient, error) {
+            return c.R().SetPathParams(map[string]string{"org": "x", "repo": "y"}).Delete("repos/{org}/{repo}")
+        }, "DELETE", "/api/repos/x/y", "application/json"},
+        // 请求自己的请求头覆盖 Client 的默认值，绝对地址不拼接 base URL
+        {func() (*HttpClient, error) {
+            h, err := c.R().Put(srv.URL + "/raw")
+            return h.Header("Accept", "text/plain"), err
+        }, "PUT", "/raw", "text/plain"},
+        {func() (*HttpClient, error) {
+            return c.R().Post("")
+        }, "POST", "/api/", "application/json"},
+    }
+    for _, tt := range tests {
+        h, err := tt.build()
+        if err != nil {
+            t.Fatal(err)
+        }
+        resp, err := h.Response()
+        if err != nil {
+            t.Fatal(err)
+        }
+        body, _ := h.Bytes()
+        if string(body) != tt.method || resp.Header.Get("X-Path") != tt.path ||
+            resp.Header.Get("X-Accept") != tt.accept || resp.Header.Get("X-Agent") != "utils/1.0" {
+            t.Errorf("%s %s: got %s %s, Accept %q, User-Agent %q", tt.method, tt.path, body,
+                resp.Header.Get("X-Path"), resp.Header.Get("X-Accept"), resp.Header.Get("X-Agent"))
+        }
+    }
+
+    // 修改请求的请求头不影响 Client
+    h, _ := c.R().Get("/")
+    h.Header("Accept", "text/html")
+    if c.header.Get("Accept") != "application/json" {
+        t.Fatalf("client header changed to %q", c.header.Get("Accept"))
+    }
+}
+
+func TestClientDefaults(t *testing.T) {
+    var attempts int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/slow" {
+            time.Sleep(200 * time.Millisecond)
+            return
+        }
+        if atomic.AddInt32(&attempts, 1) < 3 {
+            w.WriteHeader(http.StatusServiceUnavailable)
+            return
+        }
+        w.WriteHeader(http.StatusNotFound)
+    }))
+    defer srv.Close()
+
+    var intercepted int32
+    c := NewClient(srv.URL, nil).
+        SetRetryPolicy(NewBackoffPolicy(3, time.Millisecond, time.Millisecond)).
+        SetErrorOnStatus(true).
+        SetTimeout(50 * time.Millisecond).
+        Use(func(next Doer) Doer {
+            return DoerFunc(func(req *http.Request) (*http.Response, error) {
+                atomic.AddInt32(&intercepted, 1)
+                return next.Do(req)
+            })
+        })
+    h, _ := c.R().Get("/missing")
+    _, err := h.Bytes()
+    var httpErr *HTTPError
+    if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+        t.Fatalf("got %v", err)
+    }
+    if atomic.LoadInt32(&attempts) != 3 || atomic.LoadInt32(&intercepted) != 3 {
+        t.Fatalf("%d attempts, %d intercepted", attempts, intercepted)
+    }
+
+    c.SetRetryPolicy(nil)
+    h, _ = c.R().Get("/slow")
+    if _, err = h.Bytes(); err == nil {
+        t.Fatal("the client timeout is not applied")
+    }
+}
+
+func TestClientConcurrentUse(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    defer srv.Close()
+
+    c := NewClient(srv.URL, nil)
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(2)
+        go func() {
+            defer wg.Done()
+            c.SetHeader("X-Id", "1").SetTimeout(time.Second).SetTransport(&http.Transport{})
+        }()
+        go func() {
+            defer wg.Done()
+            h, err := c.R().Get("/")
+            if err == nil {
+                _, err = h.Bytes()
+            }
+            if err != nil {
+                t.Error(err)
+            }
+        }()
+    }
+    wg.Wait()
+}
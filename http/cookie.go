@@ -0,0 +1,483 @@
+package http
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "golang.org/x/net/publicsuffix"
+)
+
+// CookieJar is a http.CookieJar that can be saved to and loaded from a file, so that login sessions
+// survive restarts. Domain cookies are checked against the public suffix list, a site cannot set a
+// cookie for a whole public suffix such as .com or .co.uk. Give every client its own jar:
+//     jar := uHttp.NewCookieJar()
+//     if err := jar.Load("cookies.json"); err != nil && !os.IsNotExist(err) { ... }
+//     client := uHttp.NewClient("https://www.example.com", nil).SetCookieJar(jar)
+//     defer jar.Save("cookies.json")
+type CookieJar struct {
+    mu      sync.Mutex
+    entries map[string]map[string]*cookieEntry // eTLD+1 -> domain;path;name -> cookie
+    seq     uint64                             // 创建时间相同时按写入顺序排序
+}
+
+// cookieEntry is a stored cookie, it is also the JSON format of the saved jar.
+type cookieEntry struct {
+    Name       string    `json:"name"`
+    Value      string    `json:"value"`
+    Domain     string    `json:"domain"`
+    Path       string    `json:"path"`
+    SameSite   string    `json:"same_site,omitempty"`
+    Secure     bool      `json:"secure,omitempty"`
+    HttpOnly   bool      `json:"http_only,omitempty"`
+    HostOnly   bool      `json:"host_only,omitempty"` // 没有 Domain 属性的 cookie 只发送给设置它的 host
+    Persistent bool      `json:"persistent,omitempty"`
+    Expires    time.Time `json:"expires"`
+    Creation   time.Time `json:"creation"`
+    seq        uint64
+}
+
+func NewCookieJar() *CookieJar {
+    return &CookieJar{entries: make(map[string]map[string]*cookieEntry)}
+}
+
+func (e *cookieEntry) id() string {
+    return e.Domain + ";" + e.Path + ";" + e.Name
+}
+
+func (e *cookieEntry) expired(now time.Time) bool {
+    return e.Persistent && !e.Expires.After(now)
+}
+
+func (e *cookieEntry) cookie() *http.Cookie {
+    c := &http.Cookie{
+        Name:     e.Name,
+        Value:    e.Value,
+        Path:     e.Path,
+        Secure:   e.Secure,
+        HttpOnly: e.HttpOnly,
+    }
+    if !e.HostOnly {
+        c.Domain = e.Domain
+    }
+    if e.Persistent {
+        c.Expires = e.Expires
+    }
+    switch e.SameSite {
+    case "Strict":
+        c.SameSite = http.SameSiteStrictMode
+    case "Lax":
+        c.SameSite = http.SameSiteLaxMode
+    case "None":
+        c.SameSite = http.SameSiteNoneMode
+    }
+    return c
+}
+
+// SetCookies stores the cookies received from u, an expired cookie deletes the stored one.
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+    if u.Scheme != "http" && u.Scheme != "https" {
+        return
+    }
+    host := cookieHost(u.Host)
+    if host == "" {
+        return
+    }
+    now := time.Now()
+    j.mu.Lock()
+    defer j.mu.Unlock()
+    for _, c := range cookies {
+        e, remove, ok := newCookieEntry(c, host, u.Path, now)
+        if !ok {
+            continue
+        }
+        key := jarKey(e.Domain)
+        id := e.id()
+        if remove {
+            if submap := j.entries[key]; submap != nil {
+                delete(submap, id)
+            }
+            continue
+        }
+        j.add(key, e)
+    }
+}
+
+// add stores e, keeping the creation time of the cookie it replaces. The caller holds j.mu.
+func (j *CookieJar) add(key string, e *cookieEntry) {
+    submap := j.entries[key]
+    if submap == nil {
+        submap = make(map[string]*cookieEntry)
+        j.entries[key] = submap
+    }
+    if old, ok := submap[e.id()]; ok {
+        e.Creation, e.seq = old.Creation, old.seq
+    } else {
+        j.seq++
+        e.seq = j.seq
+    }
+    submap[e.id()] = e
+}
+
+// Cookies returns the cookies to send to u, the longest paths first.
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+    if u.Scheme != "http" && u.Scheme != "https" {
+        return nil
+    }
+    host := cookieHost(u.Host)
+    if host == "" {
+        return nil
+    }
+    reqPath := u.Path
+    if reqPath == "" {
+        reqPath = "/"
+    }
+    now := time.Now()
+    j.mu.Lock()
+    submap := j.entries[jarKey(host)]
+    var selected []*cookieEntry
+    for id, e := range submap {
+        if e.expired(now) {
+            delete(submap, id)
+            continue
+        }
+        if e.matches(host, reqPath, u.Scheme == "https") {
+            selected = append(selected, e)
+        }
+    }
+    j.mu.Unlock()
+
+    sort.Slice(selected, func(a, b int) bool {
+        ea, eb := selected[a], selected[b]
+        if len(ea.Path) != len(eb.Path) {
+            return len(ea.Path) > len(eb.Path)
+        }
+        if !ea.Creation.Equal(eb.Creation) {
+            return ea.Creation.Before(eb.Creation)
+        }
+        return ea.seq < eb.seq
+    })
+    cookies := make([]*http.Cookie, 0, len(selected))
+    for _, e := range selected {
+        cookies = append(cookies, &http.Cookie{Name: e.Name, Value: e.Value})
+    }
+    return cookies
+}
+
+// All returns every cookie of the jar that has not expired, with its domain, path and expiry.
+func (j *CookieJar) All() []*http.Cookie {
+    var cookies []*http.Cookie
+    for _, e := range j.snapshot() {
+        cookies = append(cookies, e.cookie())
+    }
+    return cookies
+}
+
+// Clear removes every cookie.
+func (j *CookieJar) Clear() {
+    j.mu.Lock()
+    j.entries = make(map[string]map[string]*cookieEntry)
+    j.mu.Unlock()
+}
+
+// snapshot returns copies of the cookies that have not expired in the order they were created,
+// so that Load restores the order in which Cookies sends cookies with the same path length.
+func (j *CookieJar) snapshot() []cookieEntry {
+    now := time.Now()
+    entries := []cookieEntry{}
+    j.mu.Lock()
+    for _, submap := range j.entries {
+        for _, e := range submap {
+            if !e.expired(now) {
+                entries = append(entries, *e)
+            }
+        }
+    }
+    j.mu.Unlock()
+    sort.Slice(entries, func(a, b int) bool {
+        if !entries[a].Creation.Equal(entries[b].Creation) {
+            return entries[a].Creation.Before(entries[b].Creation)
+        }
+        return entries[a].seq < entries[b].seq
+    })
+    return entries
+}
+
+// Save writes the cookies that have not expired, session cookies included, to path.
+// The file is a Netscape cookies.txt when path ends with .txt, JSON otherwise.
+// It writes a temp file and renames it, so that a crash never leaves a partial file.
+func (j *CookieJar) Save(path string) error {
+    entries := j.snapshot()
+    var (
+        data []byte
+        err  error
+    )
+    if strings.EqualFold(filepath.Ext(path), ".txt") {
+        data = marshalNetscape(entries)
+    } else if data, err = json.MarshalIndent(entries, "", "  "); err != nil {
+        return err
+    }
+    dir := filepath.Dir(path)
+    if err = os.MkdirAll(dir, 0755); err != nil {
+        return err
+    }
+    f, err := ioutil.TempFile(dir, ".cookies-")
+    if err != nil {
+        return err
+    }
+    _, err = f.Write(data)
+    if er := f.Close(); err == nil {
+        err = er
+    }
+    // TempFile 创建的文件只有所有者可以读写，cookie 中的登录凭证不会泄露给其他用户
+    if err == nil {
+        err = os.Rename(f.Name(), path)
+    }
+    if err != nil {
+        os.Remove(f.Name())
+    }
+    return err
+}
+
+// Load adds the cookies saved at path to the jar, replacing the ones with the same domain, path and name.
+// Both the JSON format of Save and the Netscape cookies.txt format of curl and browser extensions are detected.
+func (j *CookieJar) Load(path string) error {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    var entries []cookieEntry
+    if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+        err = json.Unmarshal(trimmed, &entries)
+    } else {
+        entries, err = unmarshalNetscape(data)
+    }
+    if err != nil {
+        return fmt.Errorf("http: load cookies %s: %w", path, err)
+    }
+    now := time.Now()
+    j.mu.Lock()
+    defer j.mu.Unlock()
+    for i := range entries {
+        e := entries[i]
+        e.Domain = strings.TrimPrefix(strings.ToLower(e.Domain), ".")
+        if e.Path == "" {
+            e.Path = "/"
+        }
+        if e.Creation.IsZero() {
+            e.Creation = now
+        }
+        if e.Name == "" || e.Domain == "" || e.expired(now) {
+            continue
+        }
+        j.add(jarKey(e.Domain), &e)
+    }
+    return nil
+}
+
+const netscapeHeader = "# Netscape HTTP Cookie File\n"
+
+// marshalNetscape writes the cookies.txt format: domain, include subdomains, path, secure, expires, name, value,
+// with #HttpOnly_ before the domain of http-only cookies and 0 as the expiry of session cookies.
+func marshalNetscape(entries []cookieEntry) []byte {
+    var buf bytes.Buffer
+    buf.WriteString(netscapeHeader)
+    for _, e := range entries {
+        domain := e.Domain
+        if !e.HostOnly {
+            domain = "." + domain
+        }
+        if e.HttpOnly {
+            domain = "#HttpOnly_" + domain
+        }
+        var expires int64
+        if e.Persistent {
+            expires = e.Expires.Unix()
+        }
+        fmt.Fprintf(&buf, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+            domain, netscapeBool(!e.HostOnly), e.Path, netscapeBool(e.Secure), expires, e.Name, e.Value)
+    }
+    return buf.Bytes()
+}
+
+func netscapeBool(b bool) string {
+    if b {
+        return "TRUE"
+    }
+    return "FALSE"
+}
+
+func unmarshalNetscape(data []byte) ([]cookieEntry, error) {
+    var entries []cookieEntry
+    scanner := bufio.NewScanner(bytes.NewReader(data))
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    for n := 1; scanner.Scan(); n++ {
+        line := strings.TrimRight(scanner.Text(), "\r")
+        httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+        if httpOnly {
+            line = strings.TrimPrefix(line, "#HttpOnly_")
+        }
+        if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        fields := strings.Split(line, "\t")
+        if len(fields) == 6 { // 值为空时有的工具会省略最后一列
+            fields = append(fields, "")
+        }
+        if len(fields) != 7 {
+            return nil, fmt.Errorf("line %d: expected 7 tab separated fields, got %d", n, len(fields))
+        }
+        expires, err := strconv.ParseInt(fields[4], 10, 64)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: invalid expiry %q", n, fields[4])
+        }
+        e := cookieEntry{
+            Name:     fields[5],
+            Value:    fields[6],
+            Domain:   fields[0],
+            Path:     fields[2],
+            Secure:   strings.EqualFold(fields[3], "TRUE"),
+            HttpOnly: httpOnly,
+            HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+        }
+        if expires > 0 {
+            e.Persistent = true
+            e.Expires = time.Unix(expires, 0)
+        }
+        entries = append(entries, e)
+    }
+    return entries, scanner.Err()
+}
+
+// newCookieEntry checks c received from host, remove reports that c deletes the stored cookie
+// and ok false that c must be ignored.
+func newCookieEntry(c *http.Cookie, host, reqPath string, now time.Time) (e *cookieEntry, remove, ok bool) {
+    e = &cookieEntry{
+        Name:     c.Name,
+        Value:    c.Value,
+        Path:     c.Path,
+        Secure:   c.Secure,
+        HttpOnly: c.HttpOnly,
+        Creation: now,
+    }
+    if e.Name == "" {
+        return nil, false, false
+    }
+    if e.Path == "" || e.Path[0] != '/' {
+        e.Path = defaultCookiePath(reqPath)
+    }
+    var err error
+    if e.Domain, e.HostOnly, err = cookieDomain(host, c.Domain); err != nil {
+        return nil, false, false
+    }
+    switch {
+    case c.MaxAge < 0:
+        return e, true, true
+    case c.MaxAge > 0:
+        e.Persistent = true
+        e.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+    case !c.Expires.IsZero():
+        if !c.Expires.After(now) {
+            return e, true, true
+        }
+        e.Persistent = true
+        e.Expires = c.Expires
+    }
+    switch c.SameSite {
+    case http.SameSiteStrictMode:
+        e.SameSite = "Strict"
+    case http.SameSiteLaxMode:
+        e.SameSite = "Lax"
+    case http.SameSiteNoneMode:
+        e.SameSite = "None"
+    }
+    return e, false, true
+}
+
+// cookieDomain returns the domain to store a cookie under and whether it is host-only, following RFC 6265 5.3.
+func cookieDomain(host, domain string) (string, bool, error) {
+    if domain == "" {
+        return host, true, nil
+    }
+    if net.ParseIP(host) != nil {
+        // IP 地址只能设置给自己
+        if domain != host {
+            return "", false, fmt.Errorf("http: cookie domain %s for ip %s", domain, host)
+        }
+        return host, true, nil
+    }
+    domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+    if domain == "" || strings.HasSuffix(domain, ".") {
+        return "", false, fmt.Errorf("http: invalid cookie domain %q", domain)
+    }
+    // 不能给公共后缀设置 cookie，除非请求的就是这个 host
+    if suffix, _ := publicsuffix.PublicSuffix(domain); suffix == domain {
+        if host == domain {
+            return host, true, nil
+        }
+        return "", false, fmt.Errorf("http: cookie domain %s is a public suffix", domain)
+    }
+    if host != domain && !strings.HasSuffix(host, "."+domain) {
+        return "", false, fmt.Errorf("http: cookie domain %s does not match host %s", domain, host)
+    }
+    return domain, false, nil
+}
+
+func (e *cookieEntry) matches(host, reqPath string, https bool) bool {
+    if e.Secure && !https {
+        return false
+    }
+    if host != e.Domain && (e.HostOnly || !strings.HasSuffix(host, "."+e.Domain)) {
+        return false
+    }
+    if reqPath == e.Path {
+        return true
+    }
+    return strings.HasPrefix(reqPath, e.Path) &&
+        (strings.HasSuffix(e.Path, "/") || reqPath[len(e.Path)] == '/')
+}
+
+// defaultCookiePath is the directory of the request path, RFC 6265 5.1.4.
+func defaultCookiePath(reqPath string) string {
+    if reqPath == "" || reqPath[0] != '/' {
+        return "/"
+    }
+    i := strings.LastIndex(reqPath, "/")
+    if i == 0 {
+        return "/"
+    }
+    return reqPath[:i]
+}
+
+// cookieHost returns the lower-cased host without port.
+func cookieHost(host string) string {
+    if h, _, err := net.SplitHostPort(host); err == nil {
+        host = h
+    }
+    host = strings.TrimSuffix(strings.Trim(strings.ToLower(host), "[]"), ".")
+    return host
+}
+
+// jarKey groups the cookies by registrable domain, so that a lookup only scans the cookies of one site.
+func jarKey(host string) string {
+    if net.ParseIP(host) != nil {
+        return host
+    }
+    key, err := publicsuffix.EffectiveTLDPlusOne(host)
+    if err != nil {
+        return host
+    }
+    return key
+}
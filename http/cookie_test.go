@@ -0,0 +1,163 @@
+package http
+
+import (
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "reflect"
+    "runtime"
+    "testing"
+    "time"
+)
+
+// cookieNames returns the names of the cookies the jar sends to rawURL.
+func cookieNames(jar http.CookieJar, rawURL string) []string {
+    u, _ := url.Parse(rawURL)
+    names := []string{}
+    for _, c := range jar.Cookies(u) {
+        names = append(names, c.Name)
+    }
+    return names
+}
+
+func TestCookieJarDomains(t *testing.T) {
+    jar := NewCookieJar()
+    u, _ := url.Parse("https://www.example.co.uk/account/login")
+    jar.SetCookies(u, []*http.Cookie{
+        {Name: "suffix", Value: "1", Domain: "co.uk"},
+        {Name: "other", Value: "1", Domain: "example.com"},
+        {Name: "site", Value: "1", Domain: ".Example.co.uk", Path: "/"},
+        {Name: "host", Value: "1"},
+        {Name: "secure", Value: "1", Path: "/", Secure: true},
+        {Name: "deleted", Value: "1", Path: "/"},
+    })
+    jar.SetCookies(u, []*http.Cookie{{Name: "deleted", Path: "/", MaxAge: -1}})
+
+    tests := []struct {
+        url   string
+        names []string
+    }{
+        // 没有 Path 的 cookie 默认使用请求路径的目录，路径长的排在前面
+        {"https://www.example.co.uk/account/settings", []string{"host", "site", "secure"}},
+        {"https://www.example.co.uk/accounting", []string{"site", "secure"}},
+        {"http://www.example.co.uk/", []string{"site"}},
+        {"https://api.example.co.uk/account/", []string{"site"}},
+        {"https://other.co.uk/", []string{}},
+        {"ftp://www.example.co.uk/", []string{}},
+    }
+    for _, tt := range tests {
+        if got := cookieNames(jar, tt.url); !reflect.DeepEqual(got, tt.names) {
+            t.Errorf("%s: got %v, want %v", tt.url, got, tt.names)
+        }
+    }
+
+    // 公共后缀本身作为 host 时可以设置只属于它的 cookie，IP 地址不能设置其他 domain
+    jar = NewCookieJar()
+    u, _ = url.Parse("http://github.io/")
+    jar.SetCookies(u, []*http.Cookie{{Name: "a", Value: "1", Domain: "github.io"}})
+    u, _ = url.Parse("http://127.0.0.1:8080/")
+    jar.SetCookies(u, []*http.Cookie{{Name: "b", Value: "1", Domain: "localhost"}, {Name: "c", Value: "1"}})
+    if got := cookieNames(jar, "http://github.io/"); !reflect.DeepEqual(got, []string{"a"}) {
+        t.Fatalf("github.io: %v", got)
+    }
+    if got := cookieNames(jar, "http://x.github.io/"); len(got) != 0 {
+        t.Fatalf("x.github.io: %v", got)
+    }
+    if got := cookieNames(jar, "http://127.0.0.1:9090/"); !reflect.DeepEqual(got, []string{"c"}) {
+        t.Fatalf("127.0.0.1: %v", got)
+    }
+}
+
+func TestCookieJarSaveLoad(t *testing.T) {
+    jar := NewCookieJar()
+    u, _ := url.Parse("https://www.example.com/")
+    expires := time.Now().Add(time.Hour).Truncate(time.Second)
+    jar.SetCookies(u, []*http.Cookie{
+        {Name: "session", Value: "s1", HttpOnly: true, Secure: true},
+        {Name: "site", Value: "v", Domain: "example.com", Path: "/app", Expires: expires},
+        {Name: "empty", Value: "", Domain: "example.com", MaxAge: 3600},
+        {Name: "gone", Value: "x", MaxAge: 1},
+    })
+    jar.SetCookies(u, []*http.Cookie{{Name: "gone", MaxAge: -1}})
+
+    dir := t.TempDir()
+    for _, name := range []string{"cookies.json", "cookies.txt"} {
+        path := filepath.Join(dir, "nested", name)
+        if err := jar.Save(path); err != nil {
+            t.Fatal(err)
+        }
+        if fi, err := os.Stat(path); err != nil || runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+            t.Fatalf("%s: %v, %v", name, fi.Mode(), err)
+        }
+        loaded := NewCookieJar()
+        if err := loaded.Load(path); err != nil {
+            t.Fatal(err)
+        }
+        got, want := loaded.All(), jar.All()
+        if len(got) != 3 || len(got) != len(want) {
+            t.Fatalf("%s: loaded %d cookies, want %d", name, len(got), len(want))
+        }
+        for i := range want {
+            // cookies.txt 只保存到秒
+            if got[i].Expires.Truncate(time.Second).Equal(want[i].Expires.Truncate(time.Second)) {
+                got[i].Expires = want[i].Expires
+            }
+            if !reflect.DeepEqual(got[i], want[i]) {
+                t.Errorf("%s: cookie %d = %+v, want %+v", name, i, got[i], want[i])
+            }
+        }
+        for _, rawURL := range []string{"https://www.example.com/app/x", "http://api.example.com/"} {
+            if got, want := cookieNames(loaded, rawURL), cookieNames(jar, rawURL); !reflect.DeepEqual(got, want) {
+                t.Errorf("%s: %s sends %v, want %v", name, rawURL, got, want)
+            }
+        }
+    }
+
+    // curl 写的 cookies.txt：值为空时省略最后一列，过期的 cookie 不加载
+    path := filepath.Join(dir, "curl.txt")
+    ioutil.WriteFile(path, []byte("# Netscape HTTP Cookie File\r\n\r\n"+
+        "#HttpOnly_.example.org\tTRUE\t/\tFALSE\t0\tsid\tabc\r\n"+
+        "example.org\tFALSE\t/\tFALSE\t0\tflag\r\n"+
+        "example.org\tFALSE\t/\tFALSE\t1\told\tx\r\n"), 0600)
+    loaded := NewCookieJar()
+    if err := loaded.Load(path); err != nil {
+        t.Fatal(err)
+    }
+    if got := cookieNames(loaded, "http://example.org/"); len(got) != 2 {
+        t.Fatalf("example.org: %v", got)
+    }
+    if got := cookieNames(loaded, "http://www.example.org/"); !reflect.DeepEqual(got, []string{"sid"}) {
+        t.Fatalf("www.example.org: %v", got)
+    }
+    ioutil.WriteFile(path, []byte("example.org\tFALSE\t/\n"), 0600)
+    if err := loaded.Load(path); err == nil {
+        t.Fatal("a malformed cookies.txt is loaded")
+    }
+}
+
+func TestCookieJarClient(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/login" {
+            http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+            return
+        }
+        if c, err := r.Cookie("session"); err == nil {
+            w.Write([]byte(c.Value))
+        }
+    }))
+    defer srv.Close()
+
+    jar := NewCookieJar()
+    c := NewClient(srv.URL, nil).SetCookieJar(jar)
+    h, _ := c.R().Post("/login")
+    if _, err := h.Bytes(); err != nil {
+        t.Fatal(err)
+    }
+    h, _ = c.R().Get("/me")
+    if body, err := h.Bytes(); err != nil || string(body) != "s1" {
+        t.Fatalf("got %q, %v", body, err)
+    }
+}
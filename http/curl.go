@@ -0,0 +1,688 @@
+package http
+
+import (
+    "bytes"
+    "context"
+    "crypto/tls"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Curl renders the request as a copy-pasteable curl command: method, url with params, headers,
+// body or form parts. The Authenticator and the signing run on a copy of the request so that
+// their headers are included, Basic and Digest credentials are rendered as -u.
+// In-memory files of PostFileReader and PostFileBytes are referenced by their file name,
+// the files of a multipart request are never read.
+func (h *HttpClient) Curl() (string, error) {
+    if err := h.prepare(); err != nil {
+        return "", err
+    }
+    req := h.request.Clone(h.ctx)
+    req.Body, req.GetBody = nil, nil
+    // multipart 请求体只根据参数和文件生成，不读取文件内容
+    multipart := len(h.files) > 0 || h.multipart
+    if !multipart && h.request.GetBody != nil {
+        body, err := h.request.GetBody()
+        if err != nil {
+            return "", err
+        }
+        req.Body, req.GetBody = body, h.request.GetBody
+    }
+    if !multipart && h.request.Body != nil && h.request.GetBody == nil {
+        // 不能重复读取的请求体读出后放回原请求
+        body, err := requestBody(h.request)
+        if err != nil {
+            return "", err
+        }
+        setRequestBody(req, body)
+    }
+
+    var args []string
+    switch a := h.auth.(type) {
+    case nil:
+    case *BasicAuth:
+        args = append(args, "-u "+shellQuote(a.Username+":"+a.Password))
+    case *DigestAuth:
+        args = append(args, "--digest", "-u "+shellQuote(a.Username+":"+a.Password))
+    default:
+        if err := a.Authenticate(req); err != nil {
+            return "", err
+        }
+    }
+    if h.signing != nil {
+        if err := h.signing.Sign(req); err != nil {
+            return "", err
+        }
+    }
+    body, err := requestBody(req)
+    if err != nil {
+        return "", err
+    }
+    if req.Body != nil {
+        req.Body.Close()
+    }
+
+    // 方法放在最前面，curl 根据有没有请求体默认使用 GET 或者 POST
+    hasBody := multipart || len(body) > 0
+    switch {
+    case req.Method == http.MethodHead:
+        args = append([]string{"-I"}, args...)
+    case req.Method == http.MethodGet && !hasBody, req.Method == http.MethodPost && hasBody:
+    default:
+        args = append([]string{"-X " + req.Method}, args...)
+    }
+
+    keys := make([]string, 0, len(req.Header))
+    for k := range req.Header {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+        // multipart 的 boundary 以及长度由 curl 生成
+        if k == "Content-Length" || k == "Transfer-Encoding" || multipart && k == "Content-Type" {
+            continue
+        }
+        for _, v := range req.Header[k] {
+            args = append(args, "-H "+shellQuote(k+": "+v))
+        }
+    }
+    if req.Host != "" && req.Host != req.URL.Host {
+        args = append(args, "-H "+shellQuote("Host: "+req.Host))
+    }
+
+    if multipart {
+        params := make([]string, 0, len(h.params))
+        for k := range h.params {
+            params = append(params, k)
+        }
+        sort.Strings(params)
+        for _, k := range params {
+            for _, v := range h.params[k] {
+                // 以 @ 或者 < 开头的值会被 -F 当作文件
+                if strings.HasPrefix(v, "@") || strings.HasPrefix(v, "<") {
+                    args = append(args, "--form-string "+shellQuote(k+"="+v))
+                } else {
+                    args = append(args, "-F "+shellQuote(k+"="+v))
+                }
+            }
+        }
+        for _, file := range h.files {
+            args = append(args, "-F "+shellQuote(h.curlFilePart(file)))
+        }
+    } else if len(body) > 0 {
+        if bytes.IndexByte(body, 0) >= 0 {
+            return "", errors.New("http: a body containing NUL bytes cannot be passed to curl on the command line")
+        }
+        args = append(args, "--data-raw "+shellQuote(string(body)))
+    }
+    if h.gzip {
+        args = append(args, "--compressed")
+    }
+    if h.proxy != "" {
+        args = append(args, "-x "+shellQuote(h.proxy))
+    }
+
+    var sb strings.Builder
+    sb.WriteString("curl " + shellQuote(req.URL.String()))
+    for _, arg := range args {
+        sb.WriteString(" \\\n  " + arg)
+    }
+    return sb.String(), nil
+}
+
+// curlFilePart renders file as the value of -F.
+func (h *HttpClient) curlFilePart(file *formFile) string {
+    part := file.field + "=@"
+    if file.path != "" {
+        part += file.path
+    } else {
+        part += file.filename
+    }
+    switch {
+    case file.contentType != "":
+        part += ";type=" + file.contentType
+    case h.fileContentType != "":
+        part += ";type=" + h.fileContentType
+    }
+    if file.path != "" && file.path != file.filename {
+        part += ";filename=" + file.filename
+    }
+    return part
+}
+
+// shellQuote quotes s for a POSIX shell, using $'...' when s holds control characters.
+func shellQuote(s string) string {
+    plain := s != ""
+    printable := true
+    for _, r := range s {
+        if r < 0x20 || r == 0x7f {
+            printable = false
+        }
+        if !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@,+%", r) {
+            plain = false
+        }
+    }
+    switch {
+    case plain:
+        return s
+    case printable:
+        return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+    }
+    var sb strings.Builder
+    sb.WriteString("$'")
+    for i := 0; i < len(s); i++ {
+        switch c := s[i]; c {
+        case '\n':
+            sb.WriteString(`\n`)
+        case '\r':
+            sb.WriteString(`\r`)
+        case '\t':
+            sb.WriteString(`\t`)
+        case '\\', '\'':
+            sb.WriteByte('\\')
+            sb.WriteByte(c)
+        default:
+            if c < 0x20 || c == 0x7f {
+                fmt.Fprintf(&sb, `\x%02x`, c)
+            } else {
+                sb.WriteByte(c)
+            }
+        }
+    }
+    sb.WriteString("'")
+    return sb.String()
+}
+
+// FromCurl parses a curl command, such as the ones copied from the browser devtools, into a ready HttpClient
+// bound to context.Background. It supports -X, -H, -d and its --data-* variants, --data-urlencode, --json,
+// -F, -u, --digest, -b, -A, -e, -G, -I, -k, -m, -x and --compressed, options that do not change the request
+// such as -s, -v or -L are ignored, and other options are an error.
+//     h, err := uHttp.FromCurl(`curl 'https://api.example.com/users' -H 'Accept: application/json' -d 'name=tom'`)
+//     body, err := h.Bytes()
+func FromCurl(cmd string) (*HttpClient, error) {
+    args, err := splitCommand(cmd)
+    if err != nil {
+        return nil, err
+    }
+    if len(args) > 0 && args[0] == "curl" {
+        args = args[1:]
+    }
+
+    var (
+        rawURL, method, user string
+        header               = make(http.Header)
+        data, cookies        []string
+        forms                []curlFormPart
+        get, head, insecure  bool
+        compressed, digest   bool
+        isJSON               bool
+        proxy                string
+        timeout              time.Duration
+    )
+    for i := 0; i < len(args); i++ {
+        arg := args[i]
+        if !strings.HasPrefix(arg, "-") {
+            rawURL = arg
+            continue
+        }
+        // 短选项可以合并，如 -sSL、-XPOST
+        var names []string
+        value := ""
+        hasValue := false
+        if strings.HasPrefix(arg, "--") {
+            names = []string{arg}
+        } else {
+            for j := 1; j < len(arg); j++ {
+                name := "-" + arg[j:j+1]
+                names = append(names, name)
+                if curlTakesValue(name) && j+1 < len(arg) {
+                    value, hasValue = arg[j+1:], true
+                    break
+                }
+            }
+        }
+        for _, name := range names {
+            if curlTakesValue(name) && !hasValue {
+                if i+1 >= len(args) {
+                    return nil, fmt.Errorf("http: curl option %s needs a value", name)
+                }
+                i++
+                value = args[i]
+            }
+            switch name {
+            case "-X", "--request":
+                method = strings.ToUpper(value)
+            case "-H", "--header":
+                k, v, err := parseCurlHeader(value)
+                if err != nil {
+                    return nil, err
+                }
+                if k != "" {
+                    header.Add(k, v)
+                }
+            case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw", "--json":
+                if value, err = curlData(name, value); err != nil {
+                    return nil, err
+                }
+                data = append(data, value)
+                isJSON = isJSON || name == "--json"
+            case "--data-urlencode":
+                if value, err = curlURLEncode(value); err != nil {
+                    return nil, err
+                }
+                data = append(data, value)
+            case "-F", "--form", "--form-string":
+                k, v, ok := strings.Cut(value, "=")
+                if !ok {
+                    return nil, fmt.Errorf("http: invalid curl form %q", value)
+                }
+                forms = append(forms, curlFormPart{name: k, value: v, plain: name == "--form-string"})
+            case "-u", "--user":
+                user = value
+            case "--digest":
+                digest = true
+            case "--basic":
+                digest = false
+            case "-b", "--cookie":
+                if !strings.Contains(value, "=") {
+                    return nil, fmt.Errorf("http: curl cookie file %q is not supported, pass the cookies inline", value)
+                }
+                cookies = append(cookies, value)
+            case "-A", "--user-agent":
+                header.Set("User-Agent", value)
+            case "-e", "--referer":
+                header.Set("Referer", value)
+            case "--url":
+                rawURL = value
+            case "-G", "--get":
+                get = true
+            case "-I", "--head":
+                head = true
+            case "-k", "--insecure":
+                insecure = true
+            case "--compressed":
+                compressed = true
+            case "-x", "--proxy":
+                proxy = value
+            case "-m", "--max-time":
+                seconds, err := strconv.ParseFloat(value, 64)
+                if err != nil {
+                    return nil, fmt.Errorf("http: invalid curl max time %q", value)
+                }
+                timeout = time.Duration(seconds * float64(time.Second))
+            case "-s", "--silent", "-S", "--show-error", "-v", "--verbose", "-i", "--include",
+                "-L", "--location", "-f", "--fail", "-g", "--globoff", "-N", "--no-buffer",
+                "--http1.1", "--http2", "--http2-prior-knowledge", "--connect-timeout", "-o", "--output":
+            default:
+                return nil, fmt.Errorf("http: unsupported curl option %s", name)
+            }
+        }
+    }
+    if rawURL == "" {
+        return nil, errors.New("http: curl command has no url")
+    }
+    if len(data) > 0 && len(forms) > 0 {
+        return nil, errors.New("http: curl command mixes -d and -F")
+    }
+    if !strings.Contains(rawURL, "://") {
+        rawURL = "http://" + rawURL
+    }
+
+    hasBody := len(forms) > 0 || len(data) > 0 && !get
+    if method == "" {
+        switch {
+        case head:
+            method = http.MethodHead
+        case hasBody:
+            method = http.MethodPost
+        default:
+            method = http.MethodGet
+        }
+    }
+    var trans http.RoundTripper
+    if insecure {
+        trans = insecureTransport()
+    }
+    h, err := NewHttpClient(context.Background(), rawURL, method, trans)
+    if err != nil {
+        return nil, err
+    }
+    if compressed {
+        // 由 Transport 协商并解压 gzip，浏览器复制出来的 br 等编码无法解压
+        header.Del("Accept-Encoding")
+        h.SetGzipOn(true)
+    }
+    for k, vs := range header {
+        for _, v := range vs {
+            h.request.Header.Add(k, v)
+        }
+    }
+    if len(cookies) > 0 {
+        h.Header("Cookie", strings.Join(cookies, "; "))
+    }
+    if user != "" {
+        name, password, _ := strings.Cut(user, ":")
+        if digest {
+            h.SetAuth(NewDigestAuth(name, password))
+        } else {
+            h.SetAuth(NewBasicAuth(name, password))
+        }
+    }
+    if timeout > 0 {
+        h.SetTimeout(timeout)
+    }
+    if proxy != "" {
+        h.SetProxy(proxy)
+    }
+
+    switch {
+    case len(forms) > 0:
+        h.multipart = true
+        for _, form := range forms {
+            if err = h.curlForm(form); err != nil {
+                return nil, err
+            }
+        }
+    case len(data) > 0 && get:
+        h.appendQuery(strings.Join(data, "&"))
+    case len(data) > 0:
+        sep := "&"
+        contentType := "application/x-www-form-urlencoded"
+        if isJSON {
+            sep, contentType = "", "application/json"
+            if h.request.Header.Get("Accept") == "" {
+                h.Header("Accept", "application/json")
+            }
+        }
+        if h.request.Header.Get("Content-Type") == "" {
+            h.Header("Content-Type", contentType)
+        }
+        h.Body(strings.Join(data, sep))
+    }
+    return h, nil
+}
+
+var (
+    insecureOnce  sync.Once
+    insecureTrans *ProxyTransport
+)
+
+// insecureTransport returns the transport shared by the -k requests of FromCurl, it is a ProxyTransport
+// so that -x reuses it as well.
+func insecureTransport() *ProxyTransport {
+    insecureOnce.Do(func() {
+        t := http.DefaultTransport.(*http.Transport).Clone()
+        t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+        insecureTrans = NewProxyTransport(t, nil)
+    })
+    return insecureTrans
+}
+
+// curlTakesValue reports whether the curl option is followed by a value.
+func curlTakesValue(name string) bool {
+    switch name {
+    case "-X", "--request", "-H", "--header", "-d", "--data", "--data-ascii", "--data-binary", "--data-raw",
+        "--json", "--data-urlencode", "-F", "--form", "--form-string", "-u", "--user", "-b", "--cookie",
+        "-A", "--user-agent", "-e", "--referer", "--url", "-x", "--proxy", "-m", "--max-time", "--connect-timeout", "-o", "--output":
+        return true
+    }
+    return false
+}
+
+// parseCurlHeader parses the value of -H, "Name:" removes a header in curl and gives an empty name here.
+func parseCurlHeader(value string) (string, string, error) {
+    if k, v, ok := strings.Cut(value, ":"); ok {
+        v = strings.TrimSpace(v)
+        if v == "" {
+            return "", "", nil
+        }
+        return strings.TrimSpace(k), v, nil
+    }
+    // "Name;" 发送空值的请求头
+    if strings.HasSuffix(value, ";") {
+        return strings.TrimSpace(strings.TrimSuffix(value, ";")), "", nil
+    }
+    return "", "", fmt.Errorf("http: invalid curl header %q", value)
+}
+
+// curlData returns the data of a -d option, @file reads the file and, except for --data-binary and --json,
+// drops its line breaks like curl does.
+func curlData(name, value string) (string, error) {
+    if name == "--data-raw" || !strings.HasPrefix(value, "@") {
+        return value, nil
+    }
+    content, err := ioutil.ReadFile(value[1:])
+    if err != nil {
+        return "", err
+    }
+    if name == "--data-binary" || name == "--json" {
+        return string(content), nil
+    }
+    return strings.NewReplacer("\r", "", "\n", "").Replace(string(content)), nil
+}
+
+// curlURLEncode returns the data of --data-urlencode: content, =content, name=content, @file or name@file.
+func curlURLEncode(value string) (string, error) {
+    name, content := "", value
+    eq, at := strings.Index(value, "="), strings.Index(value, "@")
+    if at >= 0 && (eq < 0 || at < eq) {
+        data, err := ioutil.ReadFile(value[at+1:])
+        if err != nil {
+            return "", err
+        }
+        name, content = value[:at], string(data)
+    } else if eq >= 0 {
+        name, content = value[:eq], value[eq+1:]
+    }
+    encoded := strings.ReplaceAll(url.QueryEscape(content), "+", "%20")
+    if name == "" {
+        return encoded, nil
+    }
+    return name + "=" + encoded, nil
+}
+
+// curlFormPart is a -F or --form-string option, the value of --form-string is always plain text.
+type curlFormPart struct {
+    name  string
+    value string
+    plain bool
+}
+
+// curlForm adds a -F part: name=value, name=<file for a field read from file,
+// or name=@file with optional ;type= and ;filename= for a file.
+func (h *HttpClient) curlForm(form curlFormPart) error {
+    name, value := form.name, form.value
+    switch {
+    case form.plain:
+        h.Param(name, value)
+    case strings.HasPrefix(value, "<"):
+        content, err := ioutil.ReadFile(value[1:])
+        if err != nil {
+            return err
+        }
+        h.Param(name, string(content))
+    case strings.HasPrefix(value, "@"):
+        parts := strings.Split(value[1:], ";")
+        h.PostFile(name, parts[0])
+        file := h.files[len(h.files)-1]
+        for _, part := range parts[1:] {
+            k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+            switch k {
+            case "type":
+                file.contentType = v
+            case "filename":
+                file.filename = strings.Trim(v, `"`)
+            }
+        }
+    default:
+        h.Param(name, value)
+    }
+    return nil
+}
+
+// splitCommand splits a shell command line into words, it handles single quotes, double quotes,
+// $'...' strings, backslash escapes and line continuations.
+func splitCommand(cmd string) ([]string, error) {
+    var (
+        words  []string
+        word   strings.Builder
+        inWord bool
+        s      = []rune(cmd)
+    )
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+            if inWord {
+                words = append(words, word.String())
+                word.Reset()
+                inWord = false
+            }
+        case c == '\\':
+            if i+1 < len(s) {
+                i++
+                if s[i] == '\n' {
+                    continue
+                }
+                if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+                    i++
+                    continue
+                }
+                word.WriteRune(s[i])
+            }
+            inWord = true
+        case c == '\'':
+            inWord = true
+            end := indexRune(s, i+1, '\'')
+            if end < 0 {
+                return nil, errors.New("http: unterminated single quote in curl command")
+            }
+            word.WriteString(string(s[i+1 : end]))
+            i = end
+        case c == '"':
+            inWord = true
+            i++
+            for ; i < len(s) && s[i] != '"'; i++ {
+                if s[i] == '\\' && i+1 < len(s) && strings.ContainsRune("$`\"\\\n", s[i+1]) {
+                    i++
+                    if s[i] == '\n' {
+                        continue
+                    }
+                }
+                word.WriteRune(s[i])
+            }
+            if i >= len(s) {
+                return nil, errors.New("http: unterminated double quote in curl command")
+            }
+        case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+            inWord = true
+            n, err := ansiCString(s[i+2:], &word)
+            if err != nil {
+                return nil, err
+            }
+            i += 2 + n
+        default:
+            inWord = true
+            word.WriteRune(c)
+        }
+    }
+    if inWord {
+        words = append(words, word.String())
+    }
+    return words, nil
+}
+
+func indexRune(s []rune, from int, r rune) int {
+    for i := from; i < len(s); i++ {
+        if s[i] == r {
+            return i
+        }
+    }
+    return -1
+}
+
+// ansiCString decodes the body of a $'...' string into word and returns the index of its closing quote.
+func ansiCString(s []rune, word *strings.Builder) (int, error) {
+    var buf []byte
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        if c == '\'' {
+            word.Write(buf)
+            return i, nil
+        }
+        if c != '\\' || i+1 >= len(s) {
+            buf = append(buf, string(c)...)
+            continue
+        }
+        i++
+        switch s[i] {
+        case 'n':
+            buf = append(buf, '\n')
+        case 'r':
+            buf = append(buf, '\r')
+        case 't':
+            buf = append(buf, '\t')
+        case 'a':
+            buf = append(buf, '\a')
+        case 'b':
+            buf = append(buf, '\b')
+        case 'e', 'E':
+            buf = append(buf, 0x1b)
+        case 'f':
+            buf = append(buf, '\f')
+        case 'v':
+            buf = append(buf, '\v')
+        case 'x':
+            j := i + 1
+            for j < len(s) && j < i+3 && strings.ContainsRune("0123456789abcdefABCDEF", s[j]) {
+                j++
+            }
+            if j == i+1 {
+                buf = append(buf, '\\', 'x')
+                continue
+            }
+            v, _ := strconv.ParseUint(string(s[i+1:j]), 16, 8)
+            buf = append(buf, byte(v))
+            i = j - 1
+        case 'u', 'U':
+            j := i + 1
+            max := 4
+            if s[i] == 'U' {
+                max = 8
+            }
+            for j < len(s) && j < i+1+max && strings.ContainsRune("0123456789abcdefABCDEF", s[j]) {
+                j++
+            }
+            if j == i+1 {
+                buf = append(buf, '\\', byte(s[i]))
+                continue
+            }
+            v, _ := strconv.ParseUint(string(s[i+1:j]), 16, 32)
+            buf = append(buf, string(rune(v))...)
+            i = j - 1
+        case '0', '1', '2', '3', '4', '5', '6', '7':
+            j := i
+            for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+                j++
+            }
+            v, _ := strconv.ParseUint(string(s[i:j]), 8, 16)
+            buf = append(buf, byte(v))
+            i = j - 1
+        default:
+            // \\ \' \" 以及未知的转义
+            if !strings.ContainsRune(`\'"?`, s[i]) {
+                buf = append(buf, '\\')
+            }
+            buf = append(buf, string(s[i])...)
+        }
+    }
+    return 0, errors.New("http: unterminated $'...' string in curl command")
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "strings"
+    "sync/atomic"
+    "testing"
+)
+
+// countingReader counts the Read calls on the wrapped reader.
+type countingReader struct {
+    io.Reader
+    reads int32
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+    atomic.AddInt32(&r.reads, 1)
+    return r.Reader.Read(p)
+}
+
+func TestCurlMultipartDoesNotReadFiles(t *testing.T) {
+    var got string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        f, _, err := r.FormFile("file")
+        if err != nil {
+            t.Error(err)
+            return
+        }
+        b, _ := ioutil.ReadAll(f)
+        got = string(b) + "," + r.FormValue("name")
+    }))
+    defer srv.Close()
+
+    file := &countingReader{Reader: strings.NewReader("hello")}
+    h, _ := Post(srv.URL, map[string]string{"name": "tom"})
+    h.PostFileReader("file", "a.txt", file, "text/plain")
+    cmd, err := h.Curl()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n := atomic.LoadInt32(&file.reads); n != 0 {
+        t.Fatalf("file read %d times by Curl", n)
+    }
+    for _, want := range []string{"-F name=tom", "-F 'file=@a.txt;type=text/plain'"} {
+        if !strings.Contains(cmd, want) {
+            t.Fatalf("%q not in\n%s", want, cmd)
+        }
+    }
+
+    // Curl 之后请求仍然可以正常发送
+    if _, err := h.Bytes(); err != nil {
+        t.Fatal(err)
+    }
+    if got != "hello,tom" {
+        t.Fatalf("server got %q", got)
+    }
+}
+
+func TestCurlMultipartMissingFile(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "report.csv")
+    h, _ := Post("http://example.com/upload", nil)
+    // 文件只在发送时打开
+    cmd, err := h.PostFile("file", path).Curl()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(cmd, "-F "+shellQuote("file=@"+path)) {
+        t.Fatalf("file part not rendered:\n%s", cmd)
+    }
+}
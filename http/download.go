@@ -0,0 +1,478 @@
+package http
+
+import (
+    "crypto/md5"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "hash"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// ErrChecksumMismatch is returned by Download when the downloaded file does not match the expected digest.
+var ErrChecksumMismatch = errors.New("http: checksum mismatch")
+
+var errRangeUnsupported = errors.New("http: server does not support range requests")
+
+// DownloadOptions 下载配置
+// Resume         断点续传，未完成的数据保存在 filename.part 中，再次下载时通过 Range、If-Range 继续
+// SHA256         期望的文件 SHA-256 十六进制摘要，下载完成后校验
+// MD5            期望的文件 MD5 十六进制摘要，下载完成后校验
+// Segments       并行分段下载的分段数，大于 1 时启用，服务端不支持 Range 时退化为普通下载
+// MinSegmentSize 每个分段的最小字节数，默认 1MB
+type DownloadOptions struct {
+    Resume         bool
+    SHA256         string
+    MD5            string
+    Segments       int
+    MinSegmentSize int64
+}
+
+// downloadMeta is saved next to the part file, so that an interrupted download can be resumed.
+type downloadMeta struct {
+    URL          string     `json:"url"`
+    ETag         string     `json:"etag,omitempty"`
+    LastModified string     `json:"last_modified,omitempty"`
+    Size         int64      `json:"size"`
+    Segments     []*segment `json:"segments,omitempty"`
+}
+
+// segment is the byte range [Start, End] of a segmented download, Done bytes of which are written.
+type segment struct {
+    Start int64 `json:"start"`
+    End   int64 `json:"end"`
+    Done  int64 `json:"done"`
+}
+
+func (s *segment) complete() bool {
+    return s.Start+s.Done > s.End
+}
+
+// validator returns the value for If-Range, a strong ETag is preferred over Last-Modified.
+func (m *downloadMeta) validator() string {
+    if m.ETag != "" && !strings.HasPrefix(m.ETag, "W/") {
+        return m.ETag
+    }
+    return m.LastModified
+}
+
+// Download saves the response body to filename atomically: the body goes to a temp file in the same
+// directory, which is verified and then renamed to filename.
+func (h *HttpClient) Download(filename string, opts *DownloadOptions) error {
+    if opts == nil {
+        opts = &DownloadOptions{}
+    }
+    if err := h.prepare(); err != nil {
+        return err
+    }
+    if err := pathExistAndMkdir(filename); err != nil {
+        return err
+    }
+    partName := filename + ".part"
+    if !opts.Resume {
+        os.Remove(partName)
+        os.Remove(metaName(partName))
+    }
+
+    var err error
+    temp := h.resp.StatusCode != 0 || (!opts.Resume && opts.Segments <= 1)
+    switch {
+    case temp:
+        partName, err = h.downloadOnce(filename)
+    case opts.Segments > 1:
+        err = h.downloadSegments(partName, opts)
+        if err == errRangeUnsupported {
+            err = h.downloadResume(partName)
+        }
+    default:
+        err = h.downloadResume(partName)
+    }
+    if err != nil {
+        if (temp || !opts.Resume) && partName != "" {
+            os.Remove(partName)
+            os.Remove(metaName(partName))
+        }
+        return err
+    }
+    if partName == "" {
+        return nil
+    }
+    if err = verifyChecksum(partName, opts); err != nil {
+        os.Remove(partName)
+        os.Remove(metaName(partName))
+        return err
+    }
+    os.Remove(metaName(partName))
+    return os.Rename(partName, filename)
+}
+
+// downloadOnce writes the whole response body to a new temp file and returns its name,
+// an empty name means the response has no body.
+func (h *HttpClient) downloadOnce(filename string) (string, error) {
+    resp, err := h.getResponse()
+    if err != nil {
+        return "", err
+    }
+    if resp.Body == nil {
+        return "", h.checkStatus(resp, nil)
+    }
+    defer resp.Body.Close()
+    if err = h.checkStatus(resp, resp.Body); err != nil {
+        return "", err
+    }
+    f, err := createPartFile(filename)
+    if err != nil {
+        return "", err
+    }
+    _, err = io.Copy(f, resp.Body)
+    if err == nil {
+        err = f.Sync()
+    }
+    if er := f.Close(); err == nil {
+        err = er
+    }
+    return f.Name(), err
+}
+
+// createPartFile creates a new temp file next to filename with the mode of os.Create, 0666 before umask,
+// since the temp file becomes filename. ioutil.TempFile would give 0600.
+func createPartFile(filename string) (*os.File, error) {
+    for i := 0; i < 100; i++ {
+        f, err := os.OpenFile(filename+"."+randomHex(8)+".part", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+        if os.IsExist(err) {
+            continue
+        }
+        return f, err
+    }
+    return nil, fmt.Errorf("http: cannot create a temp file for %s", filename)
+}
+
+// downloadResume continues the part file with a Range request guarded by If-Range,
+// the server answers the full body when the resource changed and the part file is rewritten.
+func (h *HttpClient) downloadResume(partName string) error {
+    var offset int64
+    meta := loadMeta(partName)
+    if fi, err := os.Stat(partName); err == nil && meta != nil && meta.URL == h.request.URL.String() && meta.validator() != "" {
+        offset = fi.Size()
+    }
+    if offset > 0 {
+        h.Header("Range", fmt.Sprintf("bytes=%d-", offset))
+        h.Header("If-Range", meta.validator())
+    }
+    resp, err := h.getResponse()
+    if err != nil {
+        return err
+    }
+    if resp.Body == nil {
+        return errors.New("http: download response has no body")
+    }
+    defer resp.Body.Close()
+
+    flag := os.O_CREATE | os.O_WRONLY
+    size := resp.ContentLength
+    switch {
+    case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+        start, _, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+        if !ok || start != offset {
+            os.Remove(partName)
+            os.Remove(metaName(partName))
+            return fmt.Errorf("http: unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+        }
+        flag |= os.O_APPEND
+        size = total
+    case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+        // 分段文件已经完整时服务端返回 416
+        if _, _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && total == offset {
+            return nil
+        }
+        os.Remove(partName)
+        os.Remove(metaName(partName))
+        return errors.New("http: requested range not satisfiable, download restarts next time")
+    default:
+        if err = h.checkStatus(resp, resp.Body); err != nil {
+            return err
+        }
+        flag |= os.O_TRUNC
+    }
+    meta = &downloadMeta{
+        URL:          h.request.URL.String(),
+        ETag:         resp.Header.Get("ETag"),
+        LastModified: resp.Header.Get("Last-Modified"),
+        Size:         size,
+    }
+    if err = saveMeta(partName, meta); err != nil {
+        return err
+    }
+    f, err := os.OpenFile(partName, flag, 0666)
+    if err != nil {
+        return err
+    }
+    _, err = io.Copy(f, resp.Body)
+    if err == nil {
+        err = f.Sync()
+    }
+    if er := f.Close(); err == nil {
+        err = er
+    }
+    return err
+}
+
+// downloadSegments fetches the file in parallel byte ranges written in place into the part file,
+// the progress of every segment is saved so that only the missing bytes are fetched on resume.
+func (h *HttpClient) downloadSegments(partName string, opts *DownloadOptions) error {
+    meta := loadMeta(partName)
+    if _, err := os.Stat(partName); err != nil || meta == nil || meta.URL != h.request.URL.String() || len(meta.Segments) == 0 {
+        var er error
+        if meta, er = h.probeSegments(opts); er != nil {
+            return er
+        }
+        f, er := os.OpenFile(partName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+        if er != nil {
+            return er
+        }
+        er = f.Truncate(meta.Size)
+        f.Close()
+        if er != nil {
+            return er
+        }
+    }
+    if err := saveMeta(partName, meta); err != nil {
+        return err
+    }
+    f, err := os.OpenFile(partName, os.O_WRONLY, 0666)
+    if err != nil {
+        return err
+    }
+
+    var (
+        wg       sync.WaitGroup
+        mu       sync.Mutex
+        firstErr error
+        changed  bool
+    )
+    for _, seg := range meta.Segments {
+        if seg.complete() {
+            continue
+        }
+        wg.Add(1)
+        go func(seg *segment) {
+            defer wg.Done()
+            er := h.fetchSegment(f, seg, meta.validator())
+            if er == nil {
+                return
+            }
+            mu.Lock()
+            if firstErr == nil {
+                firstErr = er
+            }
+            if er == errResourceChanged {
+                changed = true
+            }
+            mu.Unlock()
+        }(seg)
+    }
+    wg.Wait()
+    if er := f.Sync(); firstErr == nil {
+        firstErr = er
+    }
+    f.Close()
+    if changed {
+        os.Remove(partName)
+        os.Remove(metaName(partName))
+        return firstErr
+    }
+    if er := saveMeta(partName, meta); firstErr == nil {
+        firstErr = er
+    }
+    return firstErr
+}
+
+var errResourceChanged = errors.New("http: resource changed during download, download restarts next time")
+
+// probeSegments asks for the first byte to learn the size and validators, then splits the file.
+func (h *HttpClient) probeSegments(opts *DownloadOptions) (*downloadMeta, error) {
+    c, err := h.clone()
+    if err != nil {
+        return nil, err
+    }
+    c.Header("Range", "bytes=0-0")
+    resp, err := c.getResponse()
+    if err != nil {
+        return nil, err
+    }
+    drainBody(resp.Body)
+    if resp.StatusCode != http.StatusPartialContent {
+        return nil, errRangeUnsupported
+    }
+    _, _, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+    if !ok || total <= 0 {
+        return nil, errRangeUnsupported
+    }
+    meta := &downloadMeta{
+        URL:          h.request.URL.String(),
+        ETag:         resp.Header.Get("ETag"),
+        LastModified: resp.Header.Get("Last-Modified"),
+        Size:         total,
+    }
+    minSize := opts.MinSegmentSize
+    if minSize <= 0 {
+        minSize = 1 << 20
+    }
+    n := int64(opts.Segments)
+    if total/n < minSize {
+        n = total / minSize
+    }
+    if n < 1 {
+        n = 1
+    }
+    size := total / n
+    for i := int64(0); i < n; i++ {
+        seg := &segment{Start: i * size, End: (i+1)*size - 1}
+        if i == n-1 {
+            seg.End = total - 1
+        }
+        meta.Segments = append(meta.Segments, seg)
+    }
+    return meta, nil
+}
+
+// fetchSegment downloads the rest of seg and writes it at its offset of f.
+func (h *HttpClient) fetchSegment(f *os.File, seg *segment, validator string) error {
+    c, err := h.clone()
+    if err != nil {
+        return err
+    }
+    c.Header("Range", fmt.Sprintf("bytes=%d-%d", seg.Start+seg.Done, seg.End))
+    if validator != "" {
+        c.Header("If-Range", validator)
+    }
+    resp, err := c.getResponse()
+    if err != nil {
+        return err
+    }
+    if resp.StatusCode != http.StatusPartialContent {
+        if resp.StatusCode == http.StatusOK {
+            drainBody(resp.Body)
+            return errResourceChanged
+        }
+        return c.newHTTPError(resp, resp.Body)
+    }
+    defer resp.Body.Close()
+    buf := make([]byte, 32*1024)
+    for !seg.complete() {
+        n, er := resp.Body.Read(buf)
+        if n > 0 {
+            if rest := seg.End - seg.Start - seg.Done + 1; int64(n) > rest {
+                n = int(rest)
+            }
+            if _, err = f.WriteAt(buf[:n], seg.Start+seg.Done); err != nil {
+                return err
+            }
+            seg.Done += int64(n)
+        }
+        if er == io.EOF {
+            break
+        }
+        if er != nil {
+            return er
+        }
+    }
+    if !seg.complete() {
+        return io.ErrUnexpectedEOF
+    }
+    return nil
+}
+
+// parseContentRange parses "bytes start-end/total" and "bytes */total", total is -1 when unknown.
+func parseContentRange(value string) (start, end, total int64, ok bool) {
+    value = strings.TrimSpace(value)
+    if !strings.HasPrefix(value, "bytes ") {
+        return 0, 0, 0, false
+    }
+    value = strings.TrimPrefix(value, "bytes ")
+    i := strings.IndexByte(value, '/')
+    if i < 0 {
+        return 0, 0, 0, false
+    }
+    total = -1
+    if value[i+1:] != "*" {
+        var err error
+        if total, err = strconv.ParseInt(value[i+1:], 10, 64); err != nil {
+            return 0, 0, 0, false
+        }
+    }
+    if value[:i] == "*" {
+        return 0, 0, total, true
+    }
+    bounds := strings.SplitN(value[:i], "-", 2)
+    if len(bounds) != 2 {
+        return 0, 0, 0, false
+    }
+    start, err1 := strconv.ParseInt(bounds[0], 10, 64)
+    end, err2 := strconv.ParseInt(bounds[1], 10, 64)
+    if err1 != nil || err2 != nil {
+        return 0, 0, 0, false
+    }
+    return start, end, total, true
+}
+
+func verifyChecksum(filename string, opts *DownloadOptions) error {
+    checks := []struct {
+        name   string
+        expect string
+        hash   hash.Hash
+    }{
+        {"sha256", opts.SHA256, sha256.New()},
+        {"md5", opts.MD5, md5.New()},
+    }
+    for _, c := range checks {
+        if c.expect == "" {
+            continue
+        }
+        f, err := os.Open(filename)
+        if err != nil {
+            return err
+        }
+        _, err = io.Copy(c.hash, f)
+        f.Close()
+        if err != nil {
+            return err
+        }
+        if got := hex.EncodeToString(c.hash.Sum(nil)); !strings.EqualFold(got, c.expect) {
+            return fmt.Errorf("%w: %s expected %s, got %s", ErrChecksumMismatch, c.name, c.expect, got)
+        }
+    }
+    return nil
+}
+
+func metaName(partName string) string {
+    return partName + ".json"
+}
+
+func loadMeta(partName string) *downloadMeta {
+    data, err := ioutil.ReadFile(metaName(partName))
+    if err != nil {
+        return nil
+    }
+    meta := &downloadMeta{}
+    if json.Unmarshal(data, meta) != nil {
+        return nil
+    }
+    return meta
+}
+
+func saveMeta(partName string, meta *downloadMeta) error {
+    data, err := json.Marshal(meta)
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(metaName(partName), data, 0666)
+}
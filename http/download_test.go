@@ -0,0 +1,55 @@
+package http
+
+import (
+    "bytes"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestDownloadFileMode(t *testing.T) {
+    content := bytes.Repeat([]byte("0123456789"), 1000)
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("ETag", `"v1"`)
+        http.ServeContent(w, r, "data.bin", time.Unix(0, 0), bytes.NewReader(content))
+    }))
+    defer srv.Close()
+
+    dir := t.TempDir()
+    // 与 os.Create 创建的文件权限一致，即 0666 去掉 umask
+    ref, err := os.Create(filepath.Join(dir, "ref"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    ref.Close()
+    refInfo, _ := os.Stat(ref.Name())
+
+    for name, opts := range map[string]*DownloadOptions{
+        "once":     nil,
+        "resume":   {Resume: true},
+        "segments": {Segments: 4, MinSegmentSize: 1000},
+    } {
+        t.Run(name, func(t *testing.T) {
+            filename := filepath.Join(dir, name)
+            h, err := Get(srv.URL)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if err = h.Download(filename, opts); err != nil {
+                t.Fatal(err)
+            }
+            data, _ := ioutil.ReadFile(filename)
+            if !bytes.Equal(data, content) {
+                t.Fatalf("got %d bytes, want %d", len(data), len(content))
+            }
+            info, _ := os.Stat(filename)
+            if info.Mode().Perm() != refInfo.Mode().Perm() {
+                t.Fatalf("mode = %v, want %v", info.Mode().Perm(), refInfo.Mode().Perm())
+            }
+        })
+    }
+}
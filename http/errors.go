@@ -0,0 +1,130 @@
+package http
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net"
+    "net/http"
+    "syscall"
+)
+
+// maxErrorBody is the size of the body snippet kept by HTTPError.
+const maxErrorBody = 4096
+
+// HTTPError is returned for non-2xx responses once SetErrorOnStatus(true) is set.
+// Body holds at most the first 4KB of the response body, it is left out of Error
+// because error pages may echo tokens or personal data into the logs.
+type HTTPError struct {
+    StatusCode int
+    Status     string
+    Header     http.Header
+    Body       []byte
+    Method     string
+    URL        string
+    Attempts   int
+}
+
+func (e *HTTPError) Error() string {
+    msg := fmt.Sprintf("http: %s %s responded %s", e.Method, e.URL, e.Status)
+    if e.Attempts > 1 {
+        msg += fmt.Sprintf(" after %d attempts", e.Attempts)
+    }
+    return msg
+}
+
+// SetErrorOnStatus makes Bytes, ToJSON, ToXML, ToFile and the streaming readers
+// return an *HTTPError for non-2xx responses instead of handling the error page as data.
+func (h *HttpClient) SetErrorOnStatus(on bool) *HttpClient {
+    h.errorOnStatus = on
+
+    return h
+}
+
+// checkStatus returns an *HTTPError when the status check is on and the response is not 2xx,
+// the body is read up to the snippet size and closed in that case.
+func (h *HttpClient) checkStatus(resp *http.Response, body io.ReadCloser) error {
+    if h.statusErr != nil {
+        return h.statusErr
+    }
+    if !h.errorOnStatus || (resp.StatusCode >= 200 && resp.StatusCode < 300) {
+        return nil
+    }
+    h.statusErr = h.newHTTPError(resp, body)
+    return h.statusErr
+}
+
+func (h *HttpClient) newHTTPError(resp *http.Response, body io.ReadCloser) *HTTPError {
+    e := &HTTPError{
+        StatusCode: resp.StatusCode,
+        Status:     resp.Status,
+        Header:     resp.Header,
+        Method:     h.request.Method,
+        URL:        h.request.URL.String(),
+        Attempts:   h.attempts,
+    }
+    if e.Status == "" {
+        e.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+    }
+    if body != nil {
+        e.Body, _ = ioutil.ReadAll(io.LimitReader(body, maxErrorBody))
+        drainBody(body)
+    }
+    return e
+}
+
+// StatusCode returns the status code carried by an *HTTPError in the chain of err, 0 otherwise.
+func StatusCode(err error) int {
+    var e *HTTPError
+    if errors.As(err, &e) {
+        return e.StatusCode
+    }
+    return 0
+}
+
+// IsTimeout reports whether err is a timeout: a network timeout, a deadline exceeded,
+// or a 408/504 response.
+func IsTimeout(err error) bool {
+    if err == nil {
+        return false
+    }
+    if errors.Is(err, context.DeadlineExceeded) {
+        return true
+    }
+    var ne net.Error
+    if errors.As(err, &ne) && ne.Timeout() {
+        return true
+    }
+    code := StatusCode(err)
+    return code == http.StatusRequestTimeout || code == http.StatusGatewayTimeout
+}
+
+// IsRetryable reports whether sending the request again may succeed: timeouts, connection resets
+// and refusals, and the statuses of DefaultRetryStatus. Cancellation, open circuits and client rate limits are not retryable.
+func IsRetryable(err error) bool {
+    if err == nil {
+        return false
+    }
+    if errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrRateLimited) {
+        return false
+    }
+    if IsTimeout(err) {
+        return true
+    }
+    if code := StatusCode(err); code != 0 {
+        for _, s := range DefaultRetryStatus {
+            if s == code {
+                return true
+            }
+        }
+        return false
+    }
+    if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+        errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+        return true
+    }
+    var opErr *net.OpError
+    return errors.As(err, &opErr)
+}
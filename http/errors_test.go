@@ -0,0 +1,58 @@
+package http
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestHTTPError(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusUnauthorized)
+        w.Write([]byte(`{"error":"invalid token abc123"}`))
+    }))
+    defer srv.Close()
+
+    h, _ := Get(srv.URL + "/me")
+    _, err := h.SetErrorOnStatus(true).Bytes()
+    var he *HTTPError
+    if !errors.As(err, &he) {
+        t.Fatalf("got %v", err)
+    }
+    if he.StatusCode != http.StatusUnauthorized || he.Method != "GET" || !strings.Contains(string(he.Body), "abc123") {
+        t.Fatalf("HTTPError %+v", he)
+    }
+    // 响应体可能包含 token，不出现在错误信息中
+    if msg := err.Error(); strings.Contains(msg, "abc123") || !strings.Contains(msg, "401 Unauthorized") {
+        t.Fatalf("Error() = %q", msg)
+    }
+    if StatusCode(fmt.Errorf("wrapped: %w", err)) != http.StatusUnauthorized {
+        t.Fatal("StatusCode does not unwrap")
+    }
+}
+
+func TestErrorClassification(t *testing.T) {
+    tests := []struct {
+        err                error
+        timeout, retryable bool
+    }{
+        {context.DeadlineExceeded, true, true},
+        {context.Canceled, false, false},
+        {&HTTPError{StatusCode: http.StatusGatewayTimeout}, true, true},
+        {&HTTPError{StatusCode: http.StatusServiceUnavailable}, false, true},
+        {&HTTPError{StatusCode: http.StatusNotFound}, false, false},
+        {&CircuitOpenError{Host: "a"}, false, false},
+        {&RateLimitError{Limit: "global"}, false, false},
+        {errors.New("boom"), false, false},
+        {nil, false, false},
+    }
+    for _, tt := range tests {
+        if IsTimeout(tt.err) != tt.timeout || IsRetryable(tt.err) != tt.retryable {
+            t.Errorf("%v: IsTimeout %v, IsRetryable %v", tt.err, IsTimeout(tt.err), IsRetryable(tt.err))
+        }
+    }
+}
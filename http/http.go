@@ -9,25 +9,19 @@ import (
     "fmt"
     "io"
     "io/ioutil"
-    "log"
     "mime/multipart"
     "net/http"
-    "net/http/cookiejar"
     "net/textproto"
     "net/url"
     "os"
     "path"
     "path/filepath"
+    "sort"
     "strings"
     "sync"
     "time"
 )
 
-var (
-    defaultCookieJar http.CookieJar
-    settingMutex     sync.Mutex
-)
-
 func Get(url string) (*HttpClient, error) {
     return NewHttpClient(context.Background(), url, http.MethodGet, nil)
 }
@@ -40,59 +34,103 @@ func Post(url string, params map[string]string) (*HttpClient, error) {
     return client.MultiParams(params), nil
 }
 
-// createDefaultCookie creates a global cookiejar to store cookies.
-func createDefaultCookie() {
-    settingMutex.Lock()
-    defer settingMutex.Unlock()
-    defaultCookieJar, _ = cookiejar.New(nil)
-}
-
 type HttpClient struct {
     url             string
-    files           map[string]string // 上传文件form表单名以及文件路径
+    files           []*formFile // 上传文件，同一个form表单名可以有多个文件
+    multipart       bool        // 没有上传文件时也按 multipart 发送参数
     fileContentType string
     request         *http.Request
     client          *http.Client
     resp            *http.Response
     params          map[string][]string
+    query           url.Values // 无论请求方法都放在 query string 中的参数
     userAgent       string
-    retry           int
-    retryDelay      time.Duration
-    enableCookie    bool
+    retryPolicy     RetryPolicy
+    breaker         *CircuitBreaker
+    interceptors    []Interceptor
+    disableTracing  bool
+    logging         *LogConfig
+    prepared        bool
+    progress        func(p Progress)
+    bandwidth       *BandwidthLimiter
+    sharedBandwidth *BandwidthLimiter
+    errorOnStatus   bool
+    statusErr       error
+    attempts        int
+    auth            Authenticator
+    signing         *SignConfig
+    cache           Cache
+    rateLimiter     *RateLimiter
+    proxy           string // 单个请求使用的代理，优先于 Client 的代理以及 NO_PROXY
+    proxyClient     func() *http.Client // Client 共享的代理 http.Client，SetProxy 时使用
+    metrics         *requestMetrics
+    route           string // 指标中的路由模板
     body            []byte
     gzip            bool
+    ctx             context.Context
+    timeout         time.Duration // 单次请求超时时间，与 ctx 的整体截止时间相互独立
+}
+
+// cancelBody releases the per-attempt timeout context once the response body is closed.
+type cancelBody struct {
+    io.ReadCloser
+    cancel context.CancelFunc
 }
 
+func (c *cancelBody) Close() error {
+    err := c.ReadCloser.Close()
+    c.cancel()
+    return err
+}
+
+// NewHttpClient creates a client for one request. The request is bound to ctx,
+// so cancelling ctx or reaching its deadline aborts the request and its retries.
 func NewHttpClient(ctx context.Context, urlPath, method string, trans http.RoundTripper) (*HttpClient, error) {
+    if ctx == nil {
+        ctx = context.Background()
+    }
     if trans == nil {
         trans = http.DefaultTransport
     }
     c := &http.Client{
         Transport: trans,
     }
-    u, er := url.Parse(urlPath)
+    return newHttpClient(ctx, urlPath, method, c)
+}
+
+// newHttpClient creates a client for one request sent by c, which may be shared with other requests.
+func newHttpClient(ctx context.Context, urlPath, method string, c *http.Client) (*HttpClient, error) {
+    if ctx == nil {
+        ctx = context.Background()
+    }
+    req, er := http.NewRequestWithContext(ctx, method, urlPath, nil)
     if er != nil {
         return nil, er
     }
-    req := &http.Request{
-        URL:        u,
-        Method:     method,
-        Header:     make(http.Header),
-        Proto:      "HTTP/1.1",
-        ProtoMajor: 1,
-        ProtoMinor: 1,
-    }
     return &HttpClient{
         client:  c,
         request: req,
-        files:   make(map[string]string),
         resp:    &http.Response{},
         params:  map[string][]string{},
         body:    []byte{},
         url:     urlPath,
+        ctx:     ctx,
     }, nil
 }
 
+// Context returns the context the request is bound to.
+func (h *HttpClient) Context() context.Context {
+    return h.ctx
+}
+
+// SetTimeout sets the timeout of every single attempt, the overall deadline is still controlled by the context.
+// The timeout covers reading the response body as well.
+func (h *HttpClient) SetTimeout(timeout time.Duration) *HttpClient {
+    h.timeout = timeout
+    
+    return h
+}
+
 func (h *HttpClient) SetGzipOn(bl bool) *HttpClient {
     h.gzip = bl
     
@@ -100,7 +138,37 @@ func (h *HttpClient) SetGzipOn(bl bool) *HttpClient {
 }
 
 func (h *HttpClient) SetCookie(jar http.CookieJar) *HttpClient {
-    h.client.Jar = jar
+    // the http.Client may be shared by a Client, so it is copied instead of changed
+    c := *h.client
+    c.Jar = jar
+    h.client = &c
+    return h
+}
+
+// SetProxy sends this request through proxyURL, see ProxyURL for its format.
+// It takes precedence over the proxies and the NO_PROXY list of the Client.
+// The connections through the proxy are reused by the requests of a Client and the requests on
+// http.DefaultTransport, pass a ProxyTransport to NewHttpClient to reuse them with another transport.
+func (h *HttpClient) SetProxy(proxyURL string) *HttpClient {
+    h.proxy = proxyURL
+    if _, ok := h.client.Transport.(*ProxyTransport); !ok {
+        switch {
+        case h.proxyClient != nil:
+            h.client = h.proxyClient()
+        case h.client.Transport == nil || h.client.Transport == http.DefaultTransport:
+            c := *h.client
+            c.Transport = defaultProxyTransport
+            h.client = &c
+        default:
+            // 只属于这个请求的 transport，不保留空闲连接以免泄漏
+            t := NewProxyTransport(h.client.Transport, nil)
+            t.oneShot = true
+            c := *h.client
+            c.Transport = t
+            h.client = &c
+        }
+    }
+
     return h
 }
 
@@ -110,9 +178,34 @@ func (h *HttpClient) SetUserAgent(ua string) *HttpClient {
     return h
 }
 
+// SetRetries retries the request up to retry times with a fixed retryDelay in between.
+// retry equal to -1 retries until success or the context is done.
+// Transport errors are retried for every method, the statuses of DefaultRetryStatus only for
+// idempotent methods and requests with an Idempotency-Key header.
+// Use SetRetryPolicy for exponential backoff or to retry the statuses of POST and PATCH as well.
 func (h *HttpClient) SetRetries(retry int, retryDelay time.Duration) *HttpClient {
-    h.retry = retry
-    h.retryDelay = retryDelay
+    h.retryPolicy = &BackoffPolicy{
+        MaxRetries:               retry,
+        BaseDelay:                retryDelay,
+        MaxDelay:                 retryDelay,
+        Multiplier:               1,
+        RetryNonIdempotentErrors: true,
+    }
+    
+    return h
+}
+
+// SetCircuitBreaker routes every attempt through the per-host circuit breaker, which is usually shared between clients.
+// An open circuit fails the request with a *CircuitOpenError without dialing.
+func (h *HttpClient) SetCircuitBreaker(breaker *CircuitBreaker) *HttpClient {
+    h.breaker = breaker
+    
+    return h
+}
+
+// SetRetryPolicy sets the policy that decides whether a failed attempt is retried, nil disables retries.
+func (h *HttpClient) SetRetryPolicy(policy RetryPolicy) *HttpClient {
+    h.retryPolicy = policy
     
     return h
 }
@@ -162,31 +255,105 @@ func (h *HttpClient) MultiParams(params map[string]string) *HttpClient {
     return h
 }
 
+// formFile is one file part of a multipart form.
+type formFile struct {
+    field       string
+    filename    string
+    path        string // 磁盘上的文件路径，只有 PostFile 上传的文件才有
+    contentType string
+    open        func() (io.ReadCloser, error)
+    rewindable  bool // 是否可以重复读取，不能重复读取的文件上传失败后不会重试
+}
+
+// PostFile uploads the file at filename under formName, it can be called several times for the same formName.
 func (h *HttpClient) PostFile(formName, filename string) *HttpClient {
-    h.files[formName] = filename
+    h.files = append(h.files, &formFile{
+        field:    formName,
+        filename: filename,
+        path:     filename,
+        open: func() (io.ReadCloser, error) {
+            return os.Open(filename)
+        },
+        rewindable: true,
+    })
     
     return h
 }
 
+// PostFileReader uploads the content of r as a file named filename under formName,
+// contentType empty uses the one of SetFileContentType. An io.Seeker is rewound on retry,
+// other readers can only be sent once.
+func (h *HttpClient) PostFileReader(formName, filename string, r io.Reader, contentType string) *HttpClient {
+    seeker, rewindable := r.(io.Seeker)
+    var start int64
+    if rewindable {
+        if pos, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+            start = pos
+        } else {
+            rewindable = false
+        }
+    }
+    used := false
+    h.files = append(h.files, &formFile{
+        field:       formName,
+        filename:    filename,
+        contentType: contentType,
+        open: func() (io.ReadCloser, error) {
+            if rewindable {
+                if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+                    return nil, err
+                }
+            } else if used {
+                return nil, fmt.Errorf("http: file %s of form %s cannot be read twice", filename, formName)
+            }
+            used = true
+            return ioutil.NopCloser(r), nil
+        },
+        rewindable: rewindable,
+    })
+    
+    return h
+}
+
+// PostFileBytes uploads data as a file named filename under formName.
+func (h *HttpClient) PostFileBytes(formName, filename string, data []byte, contentType string) *HttpClient {
+    h.files = append(h.files, &formFile{
+        field:       formName,
+        filename:    filename,
+        contentType: contentType,
+        open: func() (io.ReadCloser, error) {
+            return ioutil.NopCloser(bytes.NewReader(data)), nil
+        },
+        rewindable: true,
+    })
+    
+    return h
+}
+
+// SetFileContentType sets the default content type of the file parts, application/octet-stream if empty.
 func (h *HttpClient) SetFileContentType(contentType string) *HttpClient {
     h.fileContentType = contentType
     
     return h
 }
 
-func (h *HttpClient) fileWriter(fieldName, fileName string) (io.Writer, error) {
-    body := new(bytes.Buffer)
-    writer := multipart.NewWriter(body)
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// fileWriter creates the part of file in the multipart body.
+func (h *HttpClient) fileWriter(writer *multipart.Writer, file *formFile) (io.Writer, error) {
     m := make(textproto.MIMEHeader)
     m.Set("Content-Disposition",
         fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
-            fieldName, // 参数名为file
-            filepath.Base(fileName)))
+            quoteEscaper.Replace(file.field),
+            quoteEscaper.Replace(filepath.Base(file.filename))))
     // 设置文件格式
-    if h.fileContentType == "" { // 文件的数据格式默认为数据流
-        m.Set("Content-Type", "application/octet-stream")
-    } else {
+    switch {
+    case file.contentType != "":
+        m.Set("Content-Type", file.contentType)
+    case h.fileContentType != "":
         m.Set("Content-Type", h.fileContentType)
+    default: // 文件的数据格式默认为数据流
+        m.Set("Content-Type", "application/octet-stream")
     }
     return writer.CreatePart(m)
 }
@@ -194,47 +361,26 @@ func (h *HttpClient) fileWriter(fieldName, fileName string) (io.Writer, error) {
 func (h *HttpClient) buildURL(paramBody string) {
     // build GET url with query string
     if h.request.Method == "GET" && len(paramBody) > 0 {
-        if strings.Contains(h.url, "?") {
-            h.url += "&" + paramBody
-        } else {
-            h.url = h.url + "?" + paramBody
-        }
+        h.appendQuery(paramBody)
         return
     }
     
     // build POST/PUT/PATCH url and body
     if (h.request.Method == "POST" || h.request.Method == "PUT" || h.request.Method == "PATCH" || h.request.Method == "DELETE") && h.request.Body == nil {
         // with files
-        if len(h.files) > 0 {
-            pr, pw := io.Pipe()
-            bodyWriter := multipart.NewWriter(pw)
-            go func() {
-                for formname, filename := range h.files {
-                    fileWriter, err := h.fileWriter(formname, filename)
-                    if err != nil {
-                        log.Println("Httplib:", err)
-                    }
-                    fh, err := os.Open(filename)
-                    if err != nil {
-                        log.Println("Httplib:", err)
-                    }
-                    // iocopy
-                    _, err = io.Copy(fileWriter, fh)
-                    fh.Close()
-                    if err != nil {
-                        log.Println("Httplib:", err)
-                    }
-                }
-                for k, v := range h.params {
-                    for _, vv := range v {
-                        bodyWriter.WriteField(k, vv)
-                    }
+        if len(h.files) > 0 || h.multipart {
+            boundary := multipart.NewWriter(ioutil.Discard).Boundary()
+            rewindable := true
+            for _, file := range h.files {
+                rewindable = rewindable && file.rewindable
+            }
+            if rewindable {
+                h.request.GetBody = func() (io.ReadCloser, error) {
+                    return h.multipartBody(boundary), nil
                 }
-                bodyWriter.Close()
-                pw.Close()
-            }()
-            h.Header("Content-Type", bodyWriter.FormDataContentType())
-            h.request.Body = ioutil.NopCloser(pr)
+            }
+            h.request.Body = h.multipartBody(boundary)
+            h.Header("Content-Type", "multipart/form-data; boundary="+boundary)
             h.Header("Transfer-Encoding", "chunked")
             return
         }
@@ -247,20 +393,102 @@ func (h *HttpClient) buildURL(paramBody string) {
     }
 }
 
+// appendQuery appends an encoded query string to the url.
+func (h *HttpClient) appendQuery(query string) {
+    if strings.Contains(h.url, "?") {
+        h.url += "&" + query
+    } else {
+        h.url = h.url + "?" + query
+    }
+}
+
+// multipartBody streams the params and files as a multipart form, every call creates a fresh body
+// so that the request can be sent again on retry. An error while reading a file aborts the request with that error.
+// The files are not opened before the first Read, so a body that is never sent costs nothing.
+func (h *HttpClient) multipartBody(boundary string) io.ReadCloser {
+    return &multipartReader{start: func() *io.PipeReader {
+        pr, pw := io.Pipe()
+        bodyWriter := multipart.NewWriter(pw)
+        bodyWriter.SetBoundary(boundary)
+        go func() {
+            pw.CloseWithError(h.writeMultipart(bodyWriter))
+        }()
+        return pr
+    }}
+}
+
+// multipartReader starts writing the multipart body on the first Read.
+type multipartReader struct {
+    start func() *io.PipeReader
+    once  sync.Once
+    pr    *io.PipeReader
+}
+
+func (r *multipartReader) Read(p []byte) (int, error) {
+    r.once.Do(func() {
+        r.pr = r.start()
+    })
+    return r.pr.Read(p)
+}
+
+func (r *multipartReader) Close() error {
+    // 没有读过的请求体关闭后不再启动写入
+    r.once.Do(func() {
+        r.pr, _ = io.Pipe()
+    })
+    return r.pr.Close()
+}
+
+func (h *HttpClient) writeMultipart(bodyWriter *multipart.Writer) error {
+    keys := make([]string, 0, len(h.params))
+    for k := range h.params {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+        for _, v := range h.params[k] {
+            if err := bodyWriter.WriteField(k, v); err != nil {
+                return err
+            }
+        }
+    }
+    for _, file := range h.files {
+        fileWriter, err := h.fileWriter(bodyWriter, file)
+        if err != nil {
+            return err
+        }
+        fh, err := file.open()
+        if err != nil {
+            return err
+        }
+        _, err = io.Copy(fileWriter, fh)
+        fh.Close()
+        if err != nil {
+            return fmt.Errorf("http: upload file %s: %w", file.filename, err)
+        }
+    }
+    return bodyWriter.Close()
+}
+
 func (h *HttpClient) Body(data interface{}) *HttpClient {
     switch t := data.(type) {
     case string:
-        bf := bytes.NewBufferString(t)
-        h.request.Body = ioutil.NopCloser(bf)
-        h.request.ContentLength = int64(len(t))
+        h.setBody([]byte(t))
     case []byte:
-        bf := bytes.NewBuffer(t)
-        h.request.Body = ioutil.NopCloser(bf)
-        h.request.ContentLength = int64(len(t))
+        h.setBody(t)
     }
     return h
 }
 
+// setBody sets a request body that can be re-created for every retry.
+func (h *HttpClient) setBody(data []byte) {
+    h.request.Body = ioutil.NopCloser(bytes.NewReader(data))
+    h.request.GetBody = func() (io.ReadCloser, error) {
+        return ioutil.NopCloser(bytes.NewReader(data)), nil
+    }
+    h.request.ContentLength = int64(len(data))
+}
+
 // XMLBody adds request raw body encoding by XML.
 func (h *HttpClient) XMLBody(obj interface{}) (*HttpClient, error) {
     if h.request.Body == nil && obj != nil {
@@ -268,8 +496,7 @@ func (h *HttpClient) XMLBody(obj interface{}) (*HttpClient, error) {
         if err != nil {
             return h, err
         }
-        h.request.Body = ioutil.NopCloser(bytes.NewReader(byts))
-        h.request.ContentLength = int64(len(byts))
+        h.setBody(byts)
         h.request.Header.Set("Content-Type", "application/xml")
     }
     
@@ -282,57 +509,145 @@ func (h *HttpClient) JsonBody(obj interface{}) (*HttpClient, error) {
         if err != nil {
             return h, err
         }
-        h.request.Body = ioutil.NopCloser(bytes.NewReader(by))
-        h.request.ContentLength = int64(len(by))
+        h.setBody(by)
         h.request.Header.Set("Content-Type", "application/json")
     }
     return h, nil
 }
 
 func (h *HttpClient) DoRequest() (resp *http.Response, err error) {
-    var paramBody string
-    if len(h.params) > 0 {
-        var buf bytes.Buffer
-        for k, v := range h.params {
-            for _, vv := range v {
-                buf.WriteString(url.QueryEscape(k))
-                buf.WriteByte('=')
-                buf.WriteString(url.QueryEscape(vv))
-                buf.WriteByte('&')
+    if err = h.prepare(); err != nil {
+        return nil, err
+    }
+    if h.metrics != nil {
+        record := h.observe()
+        defer func() {
+            record(resp, err)
+        }()
+    }
+    
+    // without a retry policy the request runs once,
+    // otherwise the policy decides whether to retry and how long to sleep in between.
+    for attempt := 1; ; attempt++ {
+        h.attempts = attempt
+        if attempt > 1 && h.request.GetBody != nil {
+            body, er := h.request.GetBody()
+            if er != nil {
+                return nil, er
+            }
+            h.request.Body = body
+        }
+        if h.breaker != nil {
+            if er := h.breaker.Allow(h.request.URL.Host); er != nil {
+                return nil, er
             }
         }
-        paramBody = buf.String()
-        paramBody = paramBody[0 : len(paramBody)-1]
+        resp, err = h.send(attempt)
+        if h.breaker != nil {
+            h.breaker.Record(h.request.URL.Host, resp, err)
+        }
+        if h.retryPolicy == nil {
+            break
+        }
+        retry, delay := h.retryPolicy.Retry(h.request, resp, err, attempt)
+        if !retry {
+            break
+        }
+        if resp != nil {
+            drainBody(resp.Body)
+        }
+        if er := h.sleep(delay); er != nil {
+            return nil, er
+        }
+    }
+    return resp, err
+}
+
+// prepare builds the url, body and headers of the request, it only runs once
+// so that the request can be sent again by clone.
+func (h *HttpClient) prepare() error {
+    if h.prepared {
+        return nil
+    }
+    // params are encoded sorted by key, so the same params always give the same query string and body
+    paramBody := url.Values(h.params).Encode()
+    if len(h.query) > 0 {
+        h.appendQuery(h.query.Encode())
     }
     
     h.buildURL(paramBody)
     u, er := url.Parse(h.url)
     if er != nil {
-        return nil, er
+        return er
     }
     h.request.URL = u
-    if h.enableCookie {
-        if defaultCookieJar == nil {
-            createDefaultCookie()
-        }
-        h.client.Jar = defaultCookieJar
-    }
     if h.userAgent != "" && h.request.Header.Get("User-Agent") == "" {
         h.Header("User-Agent", h.userAgent)
     }
-    
-    // retries default value is 0, it will run once.
-    // retries equal to -1, it will run forever until success
-    // retries is setted, it will retries fixed times.
-    // Sleeps for a 400ms in between calls to reduce spam
-    for i := 0; h.retry == -1 || i <= h.retry; i++ {
-        resp, err = h.client.Do(h.request)
-        if err == nil {
-            break
+    h.prepared = true
+    return nil
+}
+
+// clone returns a copy of the prepared client that has not been sent yet,
+// it is used to send extra requests such as byte ranges of a download.
+func (h *HttpClient) clone() (*HttpClient, error) {
+    if err := h.prepare(); err != nil {
+        return nil, err
+    }
+    c := *h
+    c.request = h.request.Clone(h.ctx)
+    if h.request.GetBody != nil {
+        body, err := h.request.GetBody()
+        if err != nil {
+            return nil, err
         }
-        time.Sleep(h.retryDelay)
+        c.request.Body = body
+    }
+    c.resp = &http.Response{}
+    c.body = []byte{}
+    c.interceptors = append([]Interceptor(nil), h.interceptors...)
+    return &c, nil
+}
+
+// send performs a single attempt, bounded by the per-attempt timeout when it is set.
+// Every attempt sends a clone of the request through the interceptor chain,
+// so the changes made by interceptors do not leak into the next attempt.
+func (h *HttpClient) send(attempt int) (*http.Response, error) {
+    if err := h.ctx.Err(); err != nil {
+        return nil, err
+    }
+    ctx := context.WithValue(h.ctx, clientCtxKey{}, h)
+    ctx = context.WithValue(ctx, attemptCtxKey{}, attempt)
+    var cancel context.CancelFunc = func() {}
+    if h.timeout > 0 {
+        ctx, cancel = context.WithTimeout(ctx, h.timeout)
+    }
+    req := h.request.Clone(ctx)
+    if req.Body != nil && req.Body != http.NoBody {
+        req.Body = h.wrapBody(req.Body, Upload, req.ContentLength)
+    }
+    resp, err := h.doer().Do(req)
+    if err != nil {
+        cancel()
+        return nil, err
+    }
+    resp.Body = &cancelBody{ReadCloser: h.wrapBody(resp.Body, Download, resp.ContentLength), cancel: cancel}
+    return resp, nil
+}
+
+// sleep waits for d, it returns early with the context error once the context is done.
+func (h *HttpClient) sleep(d time.Duration) error {
+    if d <= 0 {
+        return h.ctx.Err()
+    }
+    t := time.NewTimer(d)
+    defer t.Stop()
+    select {
+    case <-h.ctx.Done():
+        return h.ctx.Err()
+    case <-t.C:
+        return nil
     }
-    return resp, err
 }
 
 func (h *HttpClient) Response() (*http.Response, error) {
@@ -365,48 +680,57 @@ func (h *HttpClient) Bytes() ([]byte, error) {
     if len(h.body) > 0 {
         return h.body, nil
     }
+    reader, err := h.bodyReader()
+    if err != nil || reader == nil {
+        return nil, err
+    }
+    defer reader.Close()
+    h.body, err = ioutil.ReadAll(reader)
+    return h.body, err
+}
+
+// bodyReader returns the response body, decoded by gzip when SetGzipOn(true) is set.
+// It returns nil without error when the response has no body, the caller must close the reader.
+// With SetErrorOnStatus(true) a non-2xx response fails with an *HTTPError.
+func (h *HttpClient) bodyReader() (io.ReadCloser, error) {
     resp, err := h.getResponse()
     if err != nil {
         return nil, err
     }
     if resp.Body == nil {
-        return nil, nil
+        return nil, h.checkStatus(resp, nil)
+    }
+    if err = h.checkStatus(resp, resp.Body); err != nil {
+        return nil, err
     }
-    defer resp.Body.Close()
     if h.gzip && resp.Header.Get("Content-Encoding") == "gzip" {
         reader, err := gzip.NewReader(resp.Body)
         if err != nil {
+            resp.Body.Close()
             return nil, err
         }
-        h.body, err = ioutil.ReadAll(reader)
-        return h.body, err
+        return &gzipBody{Reader: reader, body: resp.Body}, nil
     }
-    h.body, err = ioutil.ReadAll(resp.Body)
-    return h.body, err
+    return resp.Body, nil
+}
+
+// gzipBody closes both the gzip reader and the underlying response body.
+type gzipBody struct {
+    *gzip.Reader
+    body io.ReadCloser
+}
+
+func (g *gzipBody) Close() error {
+    g.Reader.Close()
+    return g.body.Close()
 }
 
 // ToFile saves the body data in response to one file.
+// The body is written to a temp file in the same directory, which is renamed to filename once complete,
+// so an interrupted transfer never leaves a truncated file behind. Use Download to resume or verify.
 // it calls Response inner.
 func (h *HttpClient) ToFile(filename string) error {
-    resp, err := h.getResponse()
-    if err != nil {
-        return err
-    }
-    if resp.Body == nil {
-        return nil
-    }
-    defer resp.Body.Close()
-    err = pathExistAndMkdir(filename)
-    if err != nil {
-        return err
-    }
-    f, err := os.Create(filename)
-    if err != nil {
-        return err
-    }
-    defer f.Close()
-    _, err = io.Copy(f, resp.Body)
-    return err
+    return h.Download(filename, nil)
 }
 
 // Check that the file directory exists, there is no automatically created
@@ -0,0 +1,107 @@
+package http
+
+import (
+    "io/ioutil"
+    "net/http"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/reaburoa/utils/http/mockserver"
+)
+
+func TestRetriesMockServer(t *testing.T) {
+    srv := mockserver.New()
+    defer srv.Close()
+    srv.Expect("GET", "/users/42").Reply(503).Times(2).Then().Reply(200).Body("tom")
+    srv.Expect("POST", "/orders").Times(1).Reply(503)
+
+    h, _ := Get(srv.URL + "/users/42")
+    body, err := h.SetRetries(3, time.Millisecond).Bytes()
+    if err != nil || string(body) != "tom" {
+        t.Fatalf("got %q, %v", body, err)
+    }
+
+    // POST 只在传输错误时重试
+    h, _ = Post(srv.URL+"/orders", map[string]string{"sku": "a1"})
+    resp, err := h.SetRetries(3, time.Millisecond).Response()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resp.StatusCode != http.StatusServiceUnavailable {
+        t.Fatalf("status = %d", resp.StatusCode)
+    }
+    srv.AssertExpectations(t)
+}
+
+func TestGzipMockServer(t *testing.T) {
+    srv := mockserver.New()
+    defer srv.Close()
+    srv.Expect("GET", "/data").WithHeader("Accept-Encoding", "gzip").Reply(200).Body("compressed body").Gzip()
+
+    for _, explicit := range []bool{false, true} {
+        h, _ := Get(srv.URL + "/data")
+        // 自己设置 Accept-Encoding 时由 SetGzipOn 解压，否则由 Transport 解压
+        if explicit {
+            h.Header("Accept-Encoding", "gzip")
+        }
+        body, err := h.SetGzipOn(true).Bytes()
+        if err != nil || string(body) != "compressed body" {
+            t.Fatalf("explicit %v: got %q, %v", explicit, body, err)
+        }
+    }
+    srv.AssertExpectations(t)
+}
+
+func TestToFileMockServer(t *testing.T) {
+    srv := mockserver.New()
+    defer srv.Close()
+    srv.Expect("GET", "/report.csv").
+        Reply(200).Body("a,b\n1,2\n").DropAfter(4).Then().
+        Reply(200).Body("a,b\n1,2\n")
+
+    dir := t.TempDir()
+    filename := filepath.Join(dir, "report.csv")
+    h, _ := Get(srv.URL + "/report.csv")
+    if err := h.ToFile(filename); err == nil {
+        t.Fatal("interrupted transfer succeeded")
+    }
+    // 中断的下载不留下任何文件
+    if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+        t.Fatalf("%d files left after an interrupted transfer", len(entries))
+    }
+
+    h, _ = Get(srv.URL + "/report.csv")
+    if err := h.ToFile(filename); err != nil {
+        t.Fatal(err)
+    }
+    if data, _ := ioutil.ReadFile(filename); string(data) != "a,b\n1,2\n" {
+        t.Fatalf("file content %q", data)
+    }
+    srv.AssertExpectations(t)
+}
+
+func TestMultipartMockServer(t *testing.T) {
+    srv := mockserver.New()
+    defer srv.Close()
+    srv.Expect("POST", "/upload").
+        WithForm("name", "tom").
+        WithFile("avatar", "me.png").
+        WithFile("resume", "cv.txt").
+        Times(1).
+        Reply(201)
+
+    path := filepath.Join(t.TempDir(), "cv.txt")
+    if err := ioutil.WriteFile(path, []byte("resume"), 0666); err != nil {
+        t.Fatal(err)
+    }
+    h, _ := Post(srv.URL+"/upload", map[string]string{"name": "tom"})
+    resp, err := h.PostFileBytes("avatar", "me.png", []byte("png"), "image/png").PostFile("resume", path).Response()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resp.StatusCode != http.StatusCreated {
+        t.Fatalf("status = %d", resp.StatusCode)
+    }
+    srv.AssertExpectations(t)
+}
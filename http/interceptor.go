@@ -0,0 +1,99 @@
+package http
+
+import (
+    "context"
+    "net/http"
+    "net/url"
+)
+
+// Doer sends a single HTTP request, *http.Client is the innermost Doer of every chain.
+type Doer interface {
+    Do(req *http.Request) (*http.Response, error)
+}
+
+// DoerFunc adapts an ordinary function to a Doer.
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+    return f(req)
+}
+
+// Interceptor wraps the next Doer, it may change the outgoing request, inspect the response,
+// or short-circuit by returning without calling next.
+// Interceptors run around every attempt, so a retried request passes through them again.
+type Interceptor func(next Doer) Doer
+
+type clientCtxKey struct{}
+
+type attemptCtxKey struct{}
+
+// Use appends interceptors to the chain, the first one registered is the outermost.
+func (h *HttpClient) Use(interceptors ...Interceptor) *HttpClient {
+    h.interceptors = append(h.interceptors, interceptors...)
+
+    return h
+}
+
+// doer builds the interceptor chain around the underlying http.Client,
+// the built-in interceptors sit innermost so that they observe the final request.
+func (h *HttpClient) doer() Doer {
+    var d Doer = h.client
+    if !h.disableTracing {
+        d = tracingInterceptor(d)
+    }
+    if h.logging != nil {
+        d = loggingInterceptor(h.logging)(d)
+    }
+    if h.signing != nil {
+        d = signingInterceptor(h.signing)(d)
+    }
+    if h.auth != nil {
+        d = authInterceptor(h.auth)(d)
+    }
+    // 限流等待之后再认证和签名，等待期间 token 和签名时间戳不会过期
+    if h.rateLimiter != nil {
+        d = rateLimitInterceptor(h.rateLimiter)(d)
+    }
+    if h.cache != nil {
+        d = cacheInterceptor(h.cache)(d)
+    }
+    for i := len(h.interceptors) - 1; i >= 0; i-- {
+        d = h.interceptors[i](d)
+    }
+    return d
+}
+
+// ClientFromContext returns the HttpClient sending the request, interceptors call it with req.Context().
+func ClientFromContext(ctx context.Context) *HttpClient {
+    h, _ := ctx.Value(clientCtxKey{}).(*HttpClient)
+    return h
+}
+
+// AttemptFromContext returns the attempt number of the request, starting from 1, or 0 outside DoRequest.
+func AttemptFromContext(ctx context.Context) int {
+    attempt, _ := ctx.Value(attemptCtxKey{}).(int)
+    return attempt
+}
+
+// Params returns a copy of the params added by Param and MultiParams.
+func (h *HttpClient) Params() url.Values {
+    params := make(url.Values, len(h.params))
+    for k, v := range h.params {
+        params[k] = append([]string(nil), v...)
+    }
+    return params
+}
+
+// Files returns the file names to upload by form name, in the order they were added.
+func (h *HttpClient) Files() map[string][]string {
+    files := make(map[string][]string, len(h.files))
+    for _, file := range h.files {
+        files[file.field] = append(files[file.field], file.filename)
+    }
+    return files
+}
+
+// RetryPolicy returns the retry policy of the client, nil if retries are disabled.
+func (h *HttpClient) RetryPolicy() RetryPolicy {
+    return h.retryPolicy
+}
@@ -0,0 +1,108 @@
+package http
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+
+    "github.com/opentracing/opentracing-go"
+    "github.com/opentracing/opentracing-go/mocktracer"
+    "github.com/reaburoa/utils/logger"
+    "go.uber.org/zap"
+    "go.uber.org/zap/zaptest/observer"
+)
+
+// authFunc adapts a function to an Authenticator.
+type authFunc func(req *http.Request) error
+
+func (f authFunc) Authenticate(req *http.Request) error {
+    return f(req)
+}
+
+func TestInterceptorOrder(t *testing.T) {
+    core, logs := observer.New(zap.InfoLevel)
+    oldLogger, oldTracer := logger.Sugar, opentracing.GlobalTracer()
+    logger.Sugar = zap.New(core).Sugar()
+    tracer := mocktracer.New()
+    opentracing.SetGlobalTracer(tracer)
+    defer func() {
+        logger.Sugar = oldLogger
+        opentracing.SetGlobalTracer(oldTracer)
+    }()
+
+    var (
+        mu    sync.Mutex
+        order []string
+    )
+    record := func(step string) {
+        mu.Lock()
+        order = append(order, step)
+        mu.Unlock()
+    }
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("X-Signature") == "" || r.Header.Get("Mockpfx-Ids-Traceid") == "" {
+            t.Errorf("request reached the server without signature or trace: %v", r.Header)
+        }
+        record("server")
+        w.Header().Set("Cache-Control", "public, max-age=60")
+        w.Write([]byte("ok"))
+    }))
+    defer srv.Close()
+
+    store := NewMemoryCache(1 << 20)
+    limiter := NewRateLimiter().SetGlobal(0.001, 1).SetFailFast(true)
+    span := tracer.StartSpan("parent")
+    defer span.Finish()
+    ctx := opentracing.ContextWithSpan(context.Background(), span)
+    send := func(path string) error {
+        h, _ := NewHttpClient(ctx, srv.URL+path, http.MethodGet, nil)
+        h.Use(func(next Doer) Doer {
+            return DoerFunc(func(req *http.Request) (*http.Response, error) {
+                record("user")
+                return next.Do(req)
+            })
+        })
+        h.SetCache(store).SetRateLimiter(limiter).SetLogging(&LogConfig{}).
+            SetAuth(authFunc(func(req *http.Request) error {
+                record("auth")
+                req.Header.Set("Authorization", "Bearer token")
+                return nil
+            })).
+            SetSigning(&SignConfig{Key: "secret", Canonicalize: func(in *SignInput) string {
+                if in.Header.Get("Authorization") == "" {
+                    t.Error("request signed before it is authenticated")
+                }
+                record("sign")
+                return in.Method + in.Path
+            }})
+        _, err := h.Bytes()
+        return err
+    }
+
+    // 缓存命中不消耗限流令牌，也不再认证和签名
+    for i := 0; i < 2; i++ {
+        if err := send("/a"); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := send("/b"); !errors.Is(err, ErrRateLimited) {
+        t.Fatalf("got %v", err)
+    }
+    if got := strings.Join(order, ","); got != "user,auth,sign,server,user,user" {
+        t.Fatalf("order = %s", got)
+    }
+
+    // 日志看到签名后的请求，追踪在日志之内注入请求头
+    entries := logs.All()
+    if len(entries) != 1 {
+        t.Fatalf("got %d log entries", len(entries))
+    }
+    headers, _ := entries[0].ContextMap()["request_headers"].(map[string]string)
+    if headers["X-Signature"] == "" || headers["Mockpfx-Ids-Traceid"] != "" {
+        t.Fatalf("logged headers %v", headers)
+    }
+}
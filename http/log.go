@@ -0,0 +1,236 @@
+package http
+
+import (
+    "bytes"
+    "io"
+    "io/ioutil"
+    "mime"
+    "net/http"
+    "net/url"
+    "regexp"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/reaburoa/utils/logger"
+)
+
+const redacted = "***"
+
+// LogConfig 请求日志配置，日志通过 logger.Sugar 输出，未初始化 logger 时不记录
+// Body          是否记录请求体和响应体，只记录文本格式的内容，multipart、图片等二进制内容不记录
+// MaxBodySize   记录的请求体、响应体最大字节数，超出部分截断，默认 1024
+// RedactHeaders 需要脱敏的请求头、响应头，为空时使用 Authorization、Cookie、Set-Cookie、Proxy-Authorization
+// RedactFields  需要脱敏的 JSON 字段、表单字段以及 URL 参数，如 password、id_card
+type LogConfig struct {
+    Body          bool
+    MaxBodySize   int
+    RedactHeaders []string
+    RedactFields  []string
+}
+
+var defaultRedactHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// SetLogging logs every attempt with method, url, status, latency, attempt and byte counts, nil turns it off.
+// The entry of a response is written once its body is read to the end or closed.
+func (h *HttpClient) SetLogging(cfg *LogConfig) *HttpClient {
+    if cfg == nil {
+        h.logging = nil
+        return h
+    }
+    c := *cfg
+    if c.MaxBodySize <= 0 {
+        c.MaxBodySize = 1024
+    }
+    if len(c.RedactHeaders) == 0 {
+        c.RedactHeaders = defaultRedactHeaders
+    }
+    h.logging = &c
+
+    return h
+}
+
+func loggingInterceptor(cfg *LogConfig) Interceptor {
+    fieldPatterns := redactPatterns(cfg.RedactFields)
+    return func(next Doer) Doer {
+        return DoerFunc(func(req *http.Request) (*http.Response, error) {
+            if logger.Sugar == nil {
+                return next.Do(req)
+            }
+            fields := []interface{}{
+                "method", req.Method,
+                "url", redactURL(req.URL, fieldPatterns),
+                "attempt", AttemptFromContext(req.Context()),
+                "request_headers", redactHeader(req.Header, cfg.RedactHeaders),
+            }
+            // chunked 请求体的长度未知，ContentLength 为 -1，或者为 0 但是有请求体
+            if req.ContentLength > 0 || req.ContentLength == 0 && (req.Body == nil || req.Body == http.NoBody) {
+                fields = append(fields, "request_bytes", req.ContentLength)
+            }
+            // multipart 等二进制请求体不读取，避免打开上传的文件
+            if cfg.Body && req.GetBody != nil && textualBody(req.Header) {
+                if body, err := req.GetBody(); err == nil {
+                    snippet, _ := ioutil.ReadAll(io.LimitReader(body, int64(cfg.MaxBodySize)))
+                    body.Close()
+                    fields = append(fields, "request_body", redactBody(snippet, fieldPatterns))
+                }
+            }
+            start := time.Now()
+            resp, err := next.Do(req)
+            if err != nil {
+                fields = append(fields, "latency", time.Since(start).String(), "error", err.Error())
+                logger.Sugar.Errorw("Http request failed", fields...)
+                return resp, err
+            }
+            fields = append(fields,
+                "status", resp.StatusCode,
+                "response_headers", redactHeader(resp.Header, cfg.RedactHeaders),
+            )
+            resp.Body = &loggingBody{
+                ReadCloser: resp.Body,
+                cfg:        cfg,
+                logBody:    cfg.Body && textualBody(resp.Header),
+                patterns:   fieldPatterns,
+                start:      start,
+                status:     resp.StatusCode,
+                fields:     fields,
+            }
+            return resp, nil
+        })
+    }
+}
+
+// loggingBody counts the response bytes and writes the log entry when the body is finished.
+type loggingBody struct {
+    io.ReadCloser
+    cfg      *LogConfig
+    logBody  bool
+    patterns []redactPattern
+    start    time.Time
+    status   int
+    fields   []interface{}
+    n        int64
+    snippet  bytes.Buffer
+    once     sync.Once
+}
+
+func (b *loggingBody) Read(p []byte) (int, error) {
+    n, err := b.ReadCloser.Read(p)
+    b.n += int64(n)
+    if b.logBody && b.snippet.Len() < b.cfg.MaxBodySize {
+        rest := b.cfg.MaxBodySize - b.snippet.Len()
+        if rest > n {
+            rest = n
+        }
+        b.snippet.Write(p[:rest])
+    }
+    if err == io.EOF {
+        b.log(nil)
+    } else if err != nil {
+        b.log(err)
+    }
+    return n, err
+}
+
+func (b *loggingBody) Close() error {
+    err := b.ReadCloser.Close()
+    b.log(nil)
+    return err
+}
+
+func (b *loggingBody) log(err error) {
+    b.once.Do(func() {
+        fields := append(b.fields, "latency", time.Since(b.start).String(), "response_bytes", b.n)
+        if b.logBody {
+            fields = append(fields, "response_body", redactBody(b.snippet.Bytes(), b.patterns))
+        }
+        switch {
+        case err != nil:
+            fields = append(fields, "error", err.Error())
+            logger.Sugar.Errorw("Http response read failed", fields...)
+        case b.status >= http.StatusBadRequest:
+            logger.Sugar.Warnw("Http request", fields...)
+        default:
+            logger.Sugar.Infow("Http request", fields...)
+        }
+    })
+}
+
+// textualBody reports whether the body described by header is text that can be logged,
+// a body without Content-Type is assumed to be text.
+func textualBody(header http.Header) bool {
+    contentType := header.Get("Content-Type")
+    if contentType == "" {
+        return true
+    }
+    mediaType, _, err := mime.ParseMediaType(contentType)
+    if err != nil {
+        return false
+    }
+    switch {
+    case strings.HasPrefix(mediaType, "text/"),
+        strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+        return true
+    }
+    switch mediaType {
+    case "application/json", "application/xml", "application/x-www-form-urlencoded",
+        "application/javascript", "application/x-ndjson":
+        return true
+    }
+    return false
+}
+
+func redactHeader(header http.Header, names []string) map[string]string {
+    m := make(map[string]string, len(header))
+    for k, v := range header {
+        m[k] = strings.Join(v, ", ")
+    }
+    for _, name := range names {
+        key := http.CanonicalHeaderKey(name)
+        if _, ok := m[key]; ok {
+            m[key] = redacted
+        }
+    }
+    return m
+}
+
+type redactPattern struct {
+    re   *regexp.Regexp
+    repl []byte
+}
+
+// redactPatterns matches the value of the fields in JSON `"name": value` and form `name=value` bodies.
+func redactPatterns(fields []string) []redactPattern {
+    patterns := make([]redactPattern, 0, len(fields)*2)
+    for _, field := range fields {
+        name := regexp.QuoteMeta(field)
+        patterns = append(patterns,
+            redactPattern{
+                re:   regexp.MustCompile(`("` + name + `"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`),
+                repl: []byte(`${1}"` + redacted + `"`),
+            },
+            redactPattern{
+                re:   regexp.MustCompile(`((?:^|&)` + name + `=)([^&]*)`),
+                repl: []byte(`${1}` + redacted),
+            },
+        )
+    }
+    return patterns
+}
+
+// redactURL redacts the query of u with the form patterns.
+func redactURL(u *url.URL, patterns []redactPattern) string {
+    if u.RawQuery == "" || len(patterns) == 0 {
+        return u.String()
+    }
+    c := *u
+    c.RawQuery = redactBody([]byte(u.RawQuery), patterns)
+    return c.String()
+}
+
+func redactBody(body []byte, patterns []redactPattern) string {
+    for _, p := range patterns {
+        body = p.re.ReplaceAll(body, p.repl)
+    }
+    return string(body)
+}
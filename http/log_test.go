@@ -0,0 +1,83 @@
+package http
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/reaburoa/utils/logger"
+    "go.uber.org/zap"
+    "go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoggingRedactsQuery(t *testing.T) {
+    core, logs := observer.New(zap.InfoLevel)
+    old := logger.Sugar
+    logger.Sugar = zap.New(core).Sugar()
+    defer func() { logger.Sugar = old }()
+
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    defer srv.Close()
+
+    h, _ := Get(srv.URL + "/login?user=tom&password=secret")
+    if _, err := h.SetLogging(&LogConfig{RedactFields: []string{"password"}}).Bytes(); err != nil {
+        t.Fatal(err)
+    }
+    entries := logs.All()
+    if len(entries) != 1 {
+        t.Fatalf("got %d log entries", len(entries))
+    }
+    u, _ := entries[0].ContextMap()["url"].(string)
+    if strings.Contains(u, "secret") || !strings.Contains(u, "user=tom&password=***") {
+        t.Fatalf("url = %q", u)
+    }
+}
+
+func TestLoggingSkipsBinaryBodies(t *testing.T) {
+    core, logs := observer.New(zap.InfoLevel)
+    old := logger.Sugar
+    logger.Sugar = zap.New(core).Sugar()
+    defer func() { logger.Sugar = old }()
+
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/image" {
+            w.Header().Set("Content-Type", "image/png")
+        } else {
+            w.Header().Set("Content-Type", "application/json")
+        }
+        w.Write([]byte(`{"ok":true}`))
+    }))
+    defer srv.Close()
+
+    cfg := &LogConfig{Body: true}
+    h, _ := Post(srv.URL+"/upload", map[string]string{"name": "tom"})
+    if _, err := h.PostFileBytes("file", "a.png", []byte("\x89PNG"), "image/png").SetLogging(cfg).Bytes(); err != nil {
+        t.Fatal(err)
+    }
+    h, _ = Get(srv.URL + "/image")
+    if _, err := h.SetLogging(cfg).Bytes(); err != nil {
+        t.Fatal(err)
+    }
+    entries := logs.All()
+    if len(entries) != 2 {
+        t.Fatalf("got %d log entries", len(entries))
+    }
+    upload, image := entries[0].ContextMap(), entries[1].ContextMap()
+    if _, ok := upload["request_body"]; ok {
+        t.Fatalf("multipart body logged: %v", upload["request_body"])
+    }
+    // multipart 请求体是 chunked，长度未知
+    if _, ok := upload["request_bytes"]; ok {
+        t.Fatalf("request_bytes logged for a chunked body: %v", upload["request_bytes"])
+    }
+    if upload["response_body"] != `{"ok":true}` {
+        t.Fatalf("response_body = %v", upload["response_body"])
+    }
+    if _, ok := image["response_body"]; ok {
+        t.Fatalf("image body logged: %v", image["response_body"])
+    }
+    if image["request_bytes"] != int64(0) {
+        t.Fatalf("request_bytes = %v", image["request_bytes"])
+    }
+}
@@ -0,0 +1,442 @@
+package http
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/uber/jaeger-lib/metrics"
+)
+
+// 请求指标名称
+const (
+    metricRequests     = "http_client_requests_total"
+    metricDuration     = "http_client_request_duration_seconds"
+    metricInFlight     = "http_client_requests_in_flight"
+    metricResponseSize = "http_client_response_size_bytes"
+)
+
+// DefaultSizeBuckets are the response size buckets in bytes, from 256B to 64MB.
+var DefaultSizeBuckets = []float64{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20}
+
+// DefaultDurationBuckets are the latency buckets in seconds, the same as the Prometheus client.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// SetMetrics records the request count, latency, in-flight requests and response size of DoRequest in f,
+// labeled by host, method, status class (2xx, 4xx, error...) and route. The in-flight gauge counts the
+// requests of this client only, use Client.SetMetrics to count the concurrent requests of a Client together.
+func (h *HttpClient) SetMetrics(f metrics.Factory) *HttpClient {
+    h.metrics = newRequestMetrics(f)
+
+    return h
+}
+
+// SetRoute sets the route label of the metrics, a template like /users/{id} rather than the actual path.
+// Requests built by Client.R() use the path passed to Get, Post and so on.
+func (h *HttpClient) SetRoute(route string) *HttpClient {
+    h.route = route
+
+    return h
+}
+
+// requestMetrics creates the metrics of every label set once and counts the requests in flight,
+// a Client shares one between all its requests.
+type requestMetrics struct {
+    factory  metrics.Factory
+    mu       sync.Mutex
+    inFlight map[metricLabels]*inFlightGauge
+    results  map[metricLabels]*resultMetrics
+}
+
+type metricLabels struct {
+    host, method, route, status string
+}
+
+type inFlightGauge struct {
+    gauge metrics.Gauge
+    n     int64
+}
+
+// resultMetrics are the metrics of the finished requests with one status class.
+type resultMetrics struct {
+    requests metrics.Counter
+    duration metrics.Timer
+    size     metrics.Histogram
+}
+
+// newRequestMetrics returns nil for a nil factory.
+func newRequestMetrics(f metrics.Factory) *requestMetrics {
+    if f == nil {
+        return nil
+    }
+    return &requestMetrics{
+        factory:  f,
+        inFlight: make(map[metricLabels]*inFlightGauge),
+        results:  make(map[metricLabels]*resultMetrics),
+    }
+}
+
+func (l metricLabels) tags() map[string]string {
+    tags := map[string]string{"host": l.host, "method": l.method, "route": l.route}
+    if l.status != "" {
+        tags["status"] = l.status
+    }
+    return tags
+}
+
+// updateInFlight adds delta to the requests in flight with labels.
+func (m *requestMetrics) updateInFlight(labels metricLabels, delta int64) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    g, ok := m.inFlight[labels]
+    if !ok {
+        g = &inFlightGauge{gauge: m.factory.Gauge(metrics.Options{Name: metricInFlight, Tags: labels.tags(), Help: "HTTP requests in flight."})}
+        m.inFlight[labels] = g
+    }
+    g.n += delta
+    g.gauge.Update(g.n)
+}
+
+func (m *requestMetrics) result(labels metricLabels) *resultMetrics {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    r, ok := m.results[labels]
+    if !ok {
+        tags := labels.tags()
+        r = &resultMetrics{
+            requests: m.factory.Counter(metrics.Options{Name: metricRequests, Tags: tags, Help: "HTTP requests sent."}),
+            duration: m.factory.Timer(metrics.TimerOptions{Name: metricDuration, Tags: tags, Help: "HTTP request latency, retries included."}),
+            size: m.factory.Histogram(metrics.HistogramOptions{
+                Name:    metricResponseSize,
+                Tags:    tags,
+                Help:    "HTTP response body size.",
+                Buckets: DefaultSizeBuckets,
+            }),
+        }
+        m.results[labels] = r
+    }
+    return r
+}
+
+// observe starts measuring a request, the returned function records its result.
+func (h *HttpClient) observe() func(resp *http.Response, err error) {
+    m := h.metrics
+    labels := metricLabels{host: h.request.URL.Host, method: h.request.Method, route: h.route}
+    m.updateInFlight(labels, 1)
+    start := time.Now()
+
+    return func(resp *http.Response, err error) {
+        m.updateInFlight(labels, -1)
+        done := labels
+        done.status = "error"
+        if err == nil {
+            done.status = strconv.Itoa(resp.StatusCode/100) + "xx"
+        }
+        r := m.result(done)
+        r.requests.Inc(1)
+        r.duration.Record(time.Since(start))
+        if err != nil {
+            return
+        }
+        resp.Body = &sizeBody{ReadCloser: resp.Body, histogram: r.size}
+    }
+}
+
+// sizeBody counts the bytes read from a response body and records them once, at EOF or Close.
+type sizeBody struct {
+    io.ReadCloser
+    histogram metrics.Histogram
+    n         int64
+    once      sync.Once
+}
+
+func (b *sizeBody) Read(p []byte) (int, error) {
+    n, err := b.ReadCloser.Read(p)
+    b.n += int64(n)
+    if err == io.EOF {
+        b.record()
+    }
+    return n, err
+}
+
+func (b *sizeBody) Close() error {
+    b.record()
+    return b.ReadCloser.Close()
+}
+
+func (b *sizeBody) record() {
+    b.once.Do(func() {
+        b.histogram.Record(float64(b.n))
+    })
+}
+
+// MetricsRegistry is a metrics.Factory keeping its metrics in memory and exposing them
+// in the Prometheus text format, it can also be passed to open_trace.TraceConfig.Metrics.
+//     registry := uHttp.NewMetricsRegistry()
+//     http.Handle("/metrics", registry)
+//     client.SetMetrics(registry)
+type MetricsRegistry struct {
+    *metricsScope
+}
+
+type metricsScope struct {
+    store  *metricsStore
+    prefix string
+    tags   map[string]string
+}
+
+type metricsStore struct {
+    mu       sync.Mutex
+    families map[string]*metricFamily
+}
+
+type metricFamily struct {
+    name    string
+    help    string
+    kind    string // counter、gauge 或者 histogram
+    buckets []float64
+    series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+    labels string // 排好序的 {k="v",...}
+    value  int64  // counter、gauge
+    mu     sync.Mutex
+    bounds []float64 // histogram 每个桶的上限
+    counts []uint64  // histogram 每个桶的计数，不累加
+    sum    float64
+    count  uint64
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+    return &MetricsRegistry{&metricsScope{store: &metricsStore{families: make(map[string]*metricFamily)}}}
+}
+
+func (s *metricsScope) Counter(opts metrics.Options) metrics.Counter {
+    if series := s.series(opts.Name, opts.Help, "counter", opts.Tags, nil); series != nil {
+        return (*promCounter)(series)
+    }
+    return metrics.NullCounter
+}
+
+func (s *metricsScope) Gauge(opts metrics.Options) metrics.Gauge {
+    if series := s.series(opts.Name, opts.Help, "gauge", opts.Tags, nil); series != nil {
+        return (*promGauge)(series)
+    }
+    return metrics.NullGauge
+}
+
+// Timer records durations in seconds in a histogram, with DefaultDurationBuckets when opts has no buckets.
+func (s *metricsScope) Timer(opts metrics.TimerOptions) metrics.Timer {
+    buckets := DefaultDurationBuckets
+    if len(opts.Buckets) > 0 {
+        buckets = make([]float64, len(opts.Buckets))
+        for i, b := range opts.Buckets {
+            buckets[i] = b.Seconds()
+        }
+    }
+    if series := s.series(opts.Name, opts.Help, "histogram", opts.Tags, buckets); series != nil {
+        return (*promTimer)(series)
+    }
+    return metrics.NullTimer
+}
+
+func (s *metricsScope) Histogram(opts metrics.HistogramOptions) metrics.Histogram {
+    buckets := opts.Buckets
+    if len(buckets) == 0 {
+        buckets = DefaultDurationBuckets
+    }
+    if series := s.series(opts.Name, opts.Help, "histogram", opts.Tags, buckets); series != nil {
+        return (*promHistogram)(series)
+    }
+    return metrics.NullHistogram
+}
+
+// Namespace prefixes the names with scope.Name and adds scope.Tags, like the Prometheus factory of jaeger-lib.
+func (s *metricsScope) Namespace(scope metrics.NSOptions) metrics.Factory {
+    prefix := s.prefix
+    if scope.Name != "" {
+        if prefix != "" {
+            prefix += "_"
+        }
+        prefix += scope.Name
+    }
+    return &metricsScope{store: s.store, prefix: prefix, tags: mergeTags(s.tags, scope.Tags)}
+}
+
+// series returns the series of name and tags, nil when name is already used by another kind of metric.
+func (s *metricsScope) series(name, help, kind string, tags map[string]string, buckets []float64) *metricSeries {
+    if s.prefix != "" {
+        name = s.prefix + "_" + name
+    }
+    name = sanitizeMetricName(name)
+    labels := formatLabels(mergeTags(s.tags, tags))
+
+    s.store.mu.Lock()
+    defer s.store.mu.Unlock()
+    family, ok := s.store.families[name]
+    if !ok {
+        family = &metricFamily{name: name, help: help, kind: kind, buckets: buckets, series: make(map[string]*metricSeries)}
+        s.store.families[name] = family
+    }
+    if family.kind != kind {
+        return nil
+    }
+    series, ok := family.series[labels]
+    if !ok {
+        series = &metricSeries{labels: labels}
+        if kind == "histogram" {
+            series.bounds = family.buckets
+            series.counts = make([]uint64, len(family.buckets))
+        }
+        family.series[labels] = series
+    }
+    return series
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+    r.WriteTo(w)
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format, sorted by name and labels.
+func (r *MetricsRegistry) WriteTo(w io.Writer) (int64, error) {
+    var buf bytes.Buffer
+    r.store.mu.Lock()
+    names := make([]string, 0, len(r.store.families))
+    for name := range r.store.families {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        family := r.store.families[name]
+        if family.help != "" {
+            fmt.Fprintf(&buf, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(family.help))
+        }
+        fmt.Fprintf(&buf, "# TYPE %s %s\n", name, family.kind)
+        keys := make([]string, 0, len(family.series))
+        for k := range family.series {
+            keys = append(keys, k)
+        }
+        sort.Strings(keys)
+        for _, k := range keys {
+            family.writeSeries(&buf, family.series[k])
+        }
+    }
+    r.store.mu.Unlock()
+    n, err := w.Write(buf.Bytes())
+    return int64(n), err
+}
+
+func (f *metricFamily) writeSeries(buf *bytes.Buffer, s *metricSeries) {
+    if f.kind != "histogram" {
+        fmt.Fprintf(buf, "%s%s %d\n", f.name, s.labels, atomic.LoadInt64(&s.value))
+        return
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var cumulative uint64
+    for i, upper := range f.buckets {
+        cumulative += s.counts[i]
+        fmt.Fprintf(buf, "%s_bucket%s %d\n", f.name, withLabel(s.labels, "le", formatFloat(upper)), cumulative)
+    }
+    fmt.Fprintf(buf, "%s_bucket%s %d\n", f.name, withLabel(s.labels, "le", "+Inf"), s.count)
+    fmt.Fprintf(buf, "%s_sum%s %s\n", f.name, s.labels, formatFloat(s.sum))
+    fmt.Fprintf(buf, "%s_count%s %d\n", f.name, s.labels, s.count)
+}
+
+type (
+    promCounter   metricSeries
+    promGauge     metricSeries
+    promTimer     metricSeries
+    promHistogram metricSeries
+)
+
+func (c *promCounter) Inc(delta int64) {
+    atomic.AddInt64(&c.value, delta)
+}
+
+func (g *promGauge) Update(value int64) {
+    atomic.StoreInt64(&g.value, value)
+}
+
+func (t *promTimer) Record(d time.Duration) {
+    (*promHistogram)(t).Record(d.Seconds())
+}
+
+// Record adds value to the first bucket whose upper bound is not below it, values above all buckets only count in +Inf.
+func (h *promHistogram) Record(value float64) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    h.sum += value
+    h.count++
+    for i, upper := range h.bounds {
+        if value <= upper {
+            h.counts[i]++
+            return
+        }
+    }
+}
+
+func mergeTags(base, extra map[string]string) map[string]string {
+    tags := make(map[string]string, len(base)+len(extra))
+    for k, v := range base {
+        tags[k] = v
+    }
+    for k, v := range extra {
+        tags[k] = v
+    }
+    return tags
+}
+
+// formatLabels formats tags as {k1="v1",k2="v2"} sorted by name, "" without tags.
+func formatLabels(tags map[string]string) string {
+    if len(tags) == 0 {
+        return ""
+    }
+    keys := make([]string, 0, len(tags))
+    for k := range tags {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+    pairs := make([]string, len(keys))
+    for i, k := range keys {
+        pairs[i] = sanitizeMetricName(k) + `="` + escaper.Replace(tags[k]) + `"`
+    }
+    return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func withLabel(labels, name, value string) string {
+    label := name + `="` + value + `"`
+    if labels == "" {
+        return "{" + label + "}"
+    }
+    return labels[:len(labels)-1] + "," + label + "}"
+}
+
+// sanitizeMetricName replaces the characters not allowed in Prometheus names, like . and -, by _.
+func sanitizeMetricName(name string) string {
+    return strings.Map(func(r rune) rune {
+        if r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+            return r
+        }
+        return '_'
+    }, name)
+}
+
+func formatFloat(v float64) string {
+    if math.IsInf(v, 1) {
+        return "+Inf"
+    }
+    return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,125 @@
+package http
+
+import (
+    "bytes"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+
+    "github.com/uber/jaeger-lib/metrics"
+)
+
+// countingFactory counts the metrics created through it.
+type countingFactory struct {
+    metrics.Factory
+    created int32
+}
+
+func (f *countingFactory) Counter(opts metrics.Options) metrics.Counter {
+    atomic.AddInt32(&f.created, 1)
+    return f.Factory.Counter(opts)
+}
+
+func (f *countingFactory) Gauge(opts metrics.Options) metrics.Gauge {
+    atomic.AddInt32(&f.created, 1)
+    return f.Factory.Gauge(opts)
+}
+
+func (f *countingFactory) Timer(opts metrics.TimerOptions) metrics.Timer {
+    atomic.AddInt32(&f.created, 1)
+    return f.Factory.Timer(opts)
+}
+
+func (f *countingFactory) Histogram(opts metrics.HistogramOptions) metrics.Histogram {
+    atomic.AddInt32(&f.created, 1)
+    return f.Factory.Histogram(opts)
+}
+
+func exposition(r *MetricsRegistry) string {
+    var buf bytes.Buffer
+    r.WriteTo(&buf)
+    return buf.String()
+}
+
+func TestClientMetrics(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/missing" {
+            w.WriteHeader(http.StatusNotFound)
+        }
+        w.Write([]byte("hello"))
+    }))
+    defer srv.Close()
+
+    registry := NewMetricsRegistry()
+    factory := &countingFactory{Factory: registry}
+    c := NewClient(srv.URL, nil).SetMetrics(factory)
+    for i := 0; i < 5; i++ {
+        h, _ := c.R().SetPathParam("id", "42").Get("/users/{id}")
+        if _, err := h.Bytes(); err != nil {
+            t.Fatal(err)
+        }
+    }
+    h, _ := c.R().Get("/missing")
+    h.Bytes()
+
+    // 每组标签的指标只创建一次：in-flight 两个，2xx、4xx 各三个
+    if n := atomic.LoadInt32(&factory.created); n != 8 {
+        t.Fatalf("factory created %d metrics, want 8", n)
+    }
+    host := strings.TrimPrefix(srv.URL, "http://")
+    out := exposition(registry)
+    for _, want := range []string{
+        `http_client_requests_total{host="` + host + `",method="GET",route="/users/{id}",status="2xx"} 5`,
+        `http_client_requests_total{host="` + host + `",method="GET",route="/missing",status="4xx"} 1`,
+        `http_client_response_size_bytes_sum{host="` + host + `",method="GET",route="/users/{id}",status="2xx"} 25`,
+        `http_client_requests_in_flight{host="` + host + `",method="GET",route="/users/{id}"} 0`,
+    } {
+        if !strings.Contains(out, want) {
+            t.Fatalf("%s not in\n%s", want, out)
+        }
+    }
+}
+
+func TestInFlightPerClient(t *testing.T) {
+    release := make(chan struct{})
+    var arrived sync.WaitGroup
+    arrived.Add(1)
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/slow" {
+            arrived.Done()
+            <-release
+        }
+    }))
+    defer srv.Close()
+
+    // 两个 Client 使用不同的 factory 但是标签相同
+    slowRegistry, fastRegistry := NewMetricsRegistry(), NewMetricsRegistry()
+    slow := NewClient(srv.URL, nil).SetMetrics(slowRegistry)
+    fast := NewClient(srv.URL, nil).SetMetrics(fastRegistry)
+    done := make(chan struct{})
+    // 先放行慢请求，srv.Close 才不会一直等待
+    defer func() {
+        close(release)
+        <-done
+    }()
+    go func() {
+        h, _ := slow.R().Get("/slow")
+        h.SetRoute("/r").Bytes()
+        close(done)
+    }()
+    arrived.Wait()
+    h, _ := fast.R().Get("/fast")
+    if _, err := h.SetRoute("/r").Bytes(); err != nil {
+        t.Fatal(err)
+    }
+    gauge := `http_client_requests_in_flight{host="` + strings.TrimPrefix(srv.URL, "http://") + `",method="GET",route="/r"} `
+    if out := exposition(fastRegistry); !strings.Contains(out, gauge+"0") {
+        t.Fatalf("fast client in flight:\n%s", out)
+    }
+    if out := exposition(slowRegistry); !strings.Contains(out, gauge+"1") {
+        t.Fatalf("slow client in flight:\n%s", out)
+    }
+}
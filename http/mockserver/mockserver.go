@@ -0,0 +1,475 @@
+// Package mockserver is a declarative fake HTTP server for testing code built on the http package.
+//     srv := mockserver.New()
+//     defer srv.Close()
+//     srv.Expect("GET", "/users/42").WithQuery("fields", "name").
+//         Reply(503).Times(2).Then().
+//         Reply(200).JSON(map[string]string{"name": "tom"})
+//     ... call srv.URL + "/users/42?fields=name" with SetRetries(3)
+//     srv.AssertExpectations(t)
+package mockserver
+
+import (
+    "bytes"
+    "compress/gzip"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "mime"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "reflect"
+    "strings"
+    "sync"
+    "time"
+)
+
+// TestingT is the part of *testing.T used by AssertExpectations.
+type TestingT interface {
+    Helper()
+    Errorf(format string, args ...interface{})
+}
+
+// Server is an httptest.Server answering the requests by the expectations declared on it.
+// Requests matching no expectation get a 404 and are reported by Verify.
+type Server struct {
+    *httptest.Server
+    mu           sync.Mutex
+    expectations []*Expectation
+    received     []*Received
+    unexpected   []string
+}
+
+// Received is a request received by the server, with its whole body.
+type Received struct {
+    Method string
+    URL    *url.URL
+    Header http.Header
+    Body   []byte
+}
+
+func New() *Server {
+    s := &Server{}
+    s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+    return s
+}
+
+func NewTLS() *Server {
+    s := &Server{}
+    s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serve))
+    return s
+}
+
+// Expect declares an expected request, path is matched without the query string.
+func (s *Server) Expect(method, path string) *Expectation {
+    e := &Expectation{method: strings.ToUpper(method), path: path, server: s}
+    s.mu.Lock()
+    s.expectations = append(s.expectations, e)
+    s.mu.Unlock()
+    return e
+}
+
+// Received returns the requests received so far, in order.
+func (s *Server) Received() []*Received {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return append([]*Received(nil), s.received...)
+}
+
+// Verify returns an error listing the unmet expectations and the unexpected requests.
+func (s *Server) Verify() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var problems []string
+    for _, e := range s.expectations {
+        switch {
+        case e.times > 0 && e.calls != e.times:
+            problems = append(problems, fmt.Sprintf("%s expected %d calls, got %d", e, e.times, e.calls))
+        case e.times == 0 && e.calls == 0:
+            problems = append(problems, fmt.Sprintf("%s was never called", e))
+        }
+    }
+    for _, u := range s.unexpected {
+        problems = append(problems, "unexpected request "+u)
+    }
+    if len(problems) == 0 {
+        return nil
+    }
+    return fmt.Errorf("mockserver: %s", strings.Join(problems, "; "))
+}
+
+// AssertExpectations fails t when Verify returns an error.
+func (s *Server) AssertExpectations(t TestingT) {
+    t.Helper()
+    if err := s.Verify(); err != nil {
+        t.Errorf("%v", err)
+    }
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+    body, _ := ioutil.ReadAll(r.Body)
+    s.mu.Lock()
+    s.received = append(s.received, &Received{Method: r.Method, URL: r.URL, Header: r.Header.Clone(), Body: body})
+    var matched *Expectation
+    for _, e := range s.expectations {
+        if (e.times == 0 || e.calls < e.times) && e.matches(r, body) {
+            matched = e
+            break
+        }
+    }
+    var resp *Response
+    if matched != nil {
+        resp = matched.next()
+    } else {
+        s.unexpected = append(s.unexpected, r.Method+" "+r.URL.RequestURI())
+    }
+    s.mu.Unlock()
+
+    if resp == nil {
+        http.Error(w, fmt.Sprintf("mockserver: no expectation for %s %s", r.Method, r.URL.RequestURI()), http.StatusNotFound)
+        return
+    }
+    resp.write(w, r)
+}
+
+// Expectation is one expected request and the sequence of responses to it.
+type Expectation struct {
+    server    *Server
+    method    string
+    path      string
+    query     url.Values
+    header    http.Header
+    form      url.Values
+    files     map[string]string
+    jsonBody  interface{}
+    body      *string
+    matchers  []func(r *http.Request, body []byte) bool
+    times     int
+    calls     int
+    responses []*Response
+}
+
+func (e *Expectation) String() string {
+    return e.method + " " + e.path
+}
+
+// WithQuery expects the query param key to have value.
+func (e *Expectation) WithQuery(key, value string) *Expectation {
+    if e.query == nil {
+        e.query = make(url.Values)
+    }
+    e.query.Add(key, value)
+    return e
+}
+
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+    if e.header == nil {
+        e.header = make(http.Header)
+    }
+    e.header.Add(key, value)
+    return e
+}
+
+// WithJSON expects a JSON body equal to v once both are decoded, key order and spacing do not matter.
+func (e *Expectation) WithJSON(v interface{}) *Expectation {
+    data, err := json.Marshal(v)
+    if s, ok := v.(string); ok {
+        data, err = []byte(s), nil
+    }
+    if err == nil {
+        err = json.Unmarshal(data, &e.jsonBody)
+    }
+    if err != nil {
+        panic("mockserver: invalid JSON expectation: " + err.Error())
+    }
+    return e
+}
+
+// WithBody expects the body to be exactly body.
+func (e *Expectation) WithBody(body string) *Expectation {
+    e.body = &body
+    return e
+}
+
+// WithForm expects the form field key, of an urlencoded or multipart body, to have value.
+func (e *Expectation) WithForm(key, value string) *Expectation {
+    if e.form == nil {
+        e.form = make(url.Values)
+    }
+    e.form.Add(key, value)
+    return e
+}
+
+// WithFile expects a multipart file in the form field with the given file name.
+func (e *Expectation) WithFile(field, filename string) *Expectation {
+    if e.files == nil {
+        e.files = make(map[string]string)
+    }
+    e.files[field] = filename
+    return e
+}
+
+// Match adds a custom matcher, body is the whole request body.
+func (e *Expectation) Match(fn func(r *http.Request, body []byte) bool) *Expectation {
+    e.matchers = append(e.matchers, fn)
+    return e
+}
+
+// Times expects exactly n calls, the default is at least one.
+func (e *Expectation) Times(n int) *Expectation {
+    e.times = n
+    return e
+}
+
+// Reply appends a response with the given status to the sequence of the expectation.
+func (e *Expectation) Reply(status int) *Response {
+    r := &Response{expectation: e, status: status, header: make(http.Header), times: 1}
+    e.responses = append(e.responses, r)
+    return r
+}
+
+// DropConnection appends a response closing the connection without answering.
+func (e *Expectation) DropConnection() *Response {
+    r := e.Reply(0)
+    r.drop = true
+    return r
+}
+
+// next returns the response of the current call, the last response repeats once the sequence is used up.
+func (e *Expectation) next() *Response {
+    e.calls++
+    n := e.calls
+    for _, r := range e.responses {
+        if n <= r.times {
+            return r
+        }
+        n -= r.times
+    }
+    if len(e.responses) == 0 {
+        return &Response{expectation: e, status: http.StatusOK, header: make(http.Header)}
+    }
+    return e.responses[len(e.responses)-1]
+}
+
+func (e *Expectation) matches(r *http.Request, body []byte) bool {
+    if e.method != "" && e.method != r.Method {
+        return false
+    }
+    if e.path != "" && e.path != r.URL.Path {
+        return false
+    }
+    query := r.URL.Query()
+    for k, vs := range e.query {
+        if !containsAll(query[k], vs) {
+            return false
+        }
+    }
+    for k, vs := range e.header {
+        if !containsAll(r.Header.Values(k), vs) {
+            return false
+        }
+    }
+    if e.body != nil && *e.body != string(body) {
+        return false
+    }
+    if e.jsonBody != nil {
+        var got interface{}
+        if json.Unmarshal(body, &got) != nil || !reflect.DeepEqual(got, e.jsonBody) {
+            return false
+        }
+    }
+    if len(e.form) > 0 || len(e.files) > 0 {
+        form, files := parseForm(r, body)
+        for k, vs := range e.form {
+            if !containsAll(form[k], vs) {
+                return false
+            }
+        }
+        for field, filename := range e.files {
+            if !contains(files[field], filename) {
+                return false
+            }
+        }
+    }
+    for _, m := range e.matchers {
+        if !m(r, body) {
+            return false
+        }
+    }
+    return true
+}
+
+// parseForm returns the fields and the file names by field of an urlencoded or multipart body.
+func parseForm(r *http.Request, body []byte) (url.Values, map[string][]string) {
+    form := make(url.Values)
+    files := make(map[string][]string)
+    mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    switch mediaType {
+    case "application/x-www-form-urlencoded":
+        form, _ = url.ParseQuery(string(body))
+    case "multipart/form-data":
+        mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+        for {
+            part, err := mr.NextPart()
+            if err != nil {
+                break
+            }
+            if part.FileName() != "" {
+                files[part.FormName()] = append(files[part.FormName()], part.FileName())
+                continue
+            }
+            value, _ := ioutil.ReadAll(part)
+            form.Add(part.FormName(), string(value))
+        }
+    }
+    return form, files
+}
+
+func contains(values []string, v string) bool {
+    for _, value := range values {
+        if value == v {
+            return true
+        }
+    }
+    return false
+}
+
+func containsAll(values, expected []string) bool {
+    for _, v := range expected {
+        if !contains(values, v) {
+            return false
+        }
+    }
+    return true
+}
+
+// Response is one response in the sequence of an expectation.
+type Response struct {
+    expectation *Expectation
+    status      int
+    header      http.Header
+    body        []byte
+    delay       time.Duration
+    gzip        bool
+    drop        bool
+    dropAfter   int
+    times       int
+}
+
+func (r *Response) Header(key, value string) *Response {
+    r.header.Add(key, value)
+    return r
+}
+
+func (r *Response) Body(body string) *Response {
+    r.body = []byte(body)
+    return r
+}
+
+func (r *Response) Bytes(body []byte) *Response {
+    r.body = body
+    return r
+}
+
+// JSON sets the body to v marshalled as JSON and the Content-Type to application/json.
+func (r *Response) JSON(v interface{}) *Response {
+    data, err := json.Marshal(v)
+    if err != nil {
+        panic("mockserver: invalid JSON response: " + err.Error())
+    }
+    r.body = data
+    r.header.Set("Content-Type", "application/json")
+    return r
+}
+
+// Delay waits d before answering, the wait ends early when the client goes away.
+func (r *Response) Delay(d time.Duration) *Response {
+    r.delay = d
+    return r
+}
+
+// Gzip compresses the body and sets Content-Encoding: gzip.
+func (r *Response) Gzip() *Response {
+    r.gzip = true
+    return r
+}
+
+// DropAfter sends the headers and the first n bytes of the body, then closes the connection.
+func (r *Response) DropAfter(n int) *Response {
+    r.drop = true
+    r.dropAfter = n
+    return r
+}
+
+// Times repeats the response n times in the sequence before the next one.
+func (r *Response) Times(n int) *Response {
+    r.times = n
+    return r
+}
+
+// Then returns the expectation to append the next response of the sequence.
+func (r *Response) Then() *Expectation {
+    return r.expectation
+}
+
+func (r *Response) write(w http.ResponseWriter, req *http.Request) {
+    if r.delay > 0 {
+        t := time.NewTimer(r.delay)
+        select {
+        case <-req.Context().Done():
+            t.Stop()
+            return
+        case <-t.C:
+        }
+    }
+    body := r.body
+    if r.gzip {
+        var buf bytes.Buffer
+        zw := gzip.NewWriter(&buf)
+        zw.Write(body)
+        zw.Close()
+        body = buf.Bytes()
+        w.Header().Set("Content-Encoding", "gzip")
+    }
+    if r.drop && r.status == 0 {
+        hijackClose(w)
+        return
+    }
+    for k, vs := range r.header {
+        for _, v := range vs {
+            w.Header().Add(k, v)
+        }
+    }
+    status := r.status
+    if status == 0 {
+        status = http.StatusOK
+    }
+    if !r.drop {
+        w.WriteHeader(status)
+        w.Write(body)
+        return
+    }
+    // 声明完整长度但只发送一部分内容，客户端读取时会得到 unexpected EOF
+    w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+    w.WriteHeader(status)
+    n := r.dropAfter
+    if n > len(body) {
+        n = len(body)
+    }
+    w.Write(body[:n])
+    if f, ok := w.(http.Flusher); ok {
+        f.Flush()
+    }
+    hijackClose(w)
+}
+
+func hijackClose(w http.ResponseWriter) {
+    if hj, ok := w.(http.Hijacker); ok {
+        if conn, _, err := hj.Hijack(); err == nil {
+            conn.Close()
+            return
+        }
+    }
+    panic(http.ErrAbortHandler)
+}
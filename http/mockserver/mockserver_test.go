@@ -0,0 +1,199 @@
+package mockserver
+
+import (
+    "bytes"
+    "compress/gzip"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "mime/multipart"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+)
+
+// fakeT records the errors of AssertExpectations.
+type fakeT struct {
+    errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+    t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func do(t *testing.T, method, url, contentType, body string, header ...string) (*http.Response, []byte) {
+    t.Helper()
+    req, _ := http.NewRequest(method, url, strings.NewReader(body))
+    if contentType != "" {
+        req.Header.Set("Content-Type", contentType)
+    }
+    for i := 0; i+1 < len(header); i += 2 {
+        req.Header.Add(header[i], header[i+1])
+    }
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    data, err := ioutil.ReadAll(resp.Body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return resp, data
+}
+
+func TestResponseSequence(t *testing.T) {
+    srv := New()
+    defer srv.Close()
+    srv.Expect("GET", "/users/42").WithQuery("fields", "name").
+        Reply(503).Times(2).Then().
+        Reply(200).JSON(map[string]string{"name": "tom"})
+
+    var statuses []int
+    for i := 0; i < 4; i++ {
+        resp, _ := do(t, "GET", srv.URL+"/users/42?fields=name", "", "")
+        statuses = append(statuses, resp.StatusCode)
+    }
+    // 响应序列用完后重复最后一个
+    if fmt.Sprint(statuses) != "[503 503 200 200]" {
+        t.Fatalf("statuses = %v", statuses)
+    }
+    resp, body := do(t, "GET", srv.URL+"/users/42?fields=name", "", "")
+    if resp.Header.Get("Content-Type") != "application/json" || string(body) != `{"name":"tom"}` {
+        t.Fatalf("got %s %q", resp.Header.Get("Content-Type"), body)
+    }
+    srv.AssertExpectations(t)
+}
+
+func TestMatching(t *testing.T) {
+    srv := New()
+    defer srv.Close()
+    srv.Expect("POST", "/json").WithHeader("X-Trace", "t1").WithJSON(`{"a": 1, "b": [true]}`).Reply(201)
+    srv.Expect("PUT", "/raw").WithBody("hello").Reply(204)
+    srv.Expect("POST", "/form").WithForm("name", "tom").Reply(202)
+    srv.Expect("POST", "/custom").Match(func(r *http.Request, body []byte) bool {
+        return bytes.HasPrefix(body, []byte("ok"))
+    }).Reply(200)
+
+    tests := []struct {
+        method, path, contentType, body string
+        header                          []string
+        status                          int
+    }{
+        {"POST", "/json", "application/json", `{"b":[true],"a":1}`, []string{"X-Trace", "t1"}, 201},
+        {"POST", "/json", "application/json", `{"b":[true],"a":1}`, nil, 404},
+        {"POST", "/json", "application/json", `{"a":2,"b":[true]}`, []string{"X-Trace", "t1"}, 404},
+        {"PUT", "/raw", "", "hello", nil, 204},
+        {"PUT", "/raw", "", "hello!", nil, 404},
+        {"POST", "/form", "application/x-www-form-urlencoded", "age=3&name=tom", nil, 202},
+        {"POST", "/form", "application/x-www-form-urlencoded", "name=jerry", nil, 404},
+        {"POST", "/custom", "", "ok!", nil, 200},
+        {"GET", "/custom", "", "ok!", nil, 404},
+    }
+    for _, tt := range tests {
+        resp, _ := do(t, tt.method, srv.URL+tt.path, tt.contentType, tt.body, tt.header...)
+        if resp.StatusCode != tt.status {
+            t.Errorf("%s %s %q: status %d, want %d", tt.method, tt.path, tt.body, resp.StatusCode, tt.status)
+        }
+    }
+    if got := len(srv.Received()); got != len(tests) {
+        t.Fatalf("received %d requests, want %d", got, len(tests))
+    }
+    if err := srv.Verify(); err == nil || !strings.Contains(err.Error(), "unexpected request GET /custom") {
+        t.Fatalf("Verify() = %v", err)
+    }
+}
+
+func TestMultipartFile(t *testing.T) {
+    srv := New()
+    defer srv.Close()
+    srv.Expect("POST", "/upload").WithForm("kind", "avatar").WithFile("file", "me.png").Reply(200)
+
+    var buf bytes.Buffer
+    mw := multipart.NewWriter(&buf)
+    mw.WriteField("kind", "avatar")
+    fw, _ := mw.CreateFormFile("file", "me.png")
+    fw.Write([]byte("png"))
+    mw.Close()
+    if resp, _ := do(t, "POST", srv.URL+"/upload", mw.FormDataContentType(), buf.String()); resp.StatusCode != 200 {
+        t.Fatalf("status = %d", resp.StatusCode)
+    }
+    if got := srv.Received()[0].Body; !bytes.Equal(got, buf.Bytes()) {
+        t.Fatalf("received body %q", got)
+    }
+}
+
+func TestTimesAndVerify(t *testing.T) {
+    srv := New()
+    defer srv.Close()
+    srv.Expect("GET", "/once").Times(1)
+    srv.Expect("GET", "/twice").Times(2)
+    srv.Expect("GET", "/never")
+
+    for _, path := range []string{"/once", "/once", "/twice"} {
+        do(t, "GET", srv.URL+path, "", "")
+    }
+    ft := &fakeT{}
+    srv.AssertExpectations(ft)
+    if len(ft.errors) != 1 {
+        t.Fatalf("errors = %q", ft.errors)
+    }
+    for _, want := range []string{"GET /twice expected 2 calls, got 1", "GET /never was never called", "unexpected request GET /once"} {
+        if !strings.Contains(ft.errors[0], want) {
+            t.Errorf("%q not in %q", want, ft.errors[0])
+        }
+    }
+}
+
+func TestGzip(t *testing.T) {
+    srv := New()
+    defer srv.Close()
+    srv.Expect("GET", "/gz").Reply(200).Body("compressed").Gzip()
+
+    req, _ := http.NewRequest("GET", srv.URL+"/gz", nil)
+    resp, err := (&http.Transport{DisableCompression: true}).RoundTrip(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    if resp.Header.Get("Content-Encoding") != "gzip" {
+        t.Fatalf("Content-Encoding = %q", resp.Header.Get("Content-Encoding"))
+    }
+    zr, err := gzip.NewReader(resp.Body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if body, _ := ioutil.ReadAll(zr); string(body) != "compressed" {
+        t.Fatalf("body = %q", body)
+    }
+}
+
+func TestFailures(t *testing.T) {
+    srv := New()
+    defer srv.Close()
+    srv.Expect("GET", "/drop").DropConnection()
+    srv.Expect("GET", "/partial").Reply(200).Body("0123456789").DropAfter(4)
+    srv.Expect("GET", "/slow").Reply(200).Delay(time.Second)
+
+    if _, err := http.Get(srv.URL + "/drop"); err == nil {
+        t.Fatal("dropped connection succeeded")
+    }
+
+    resp, err := http.Get(srv.URL + "/partial")
+    if err != nil {
+        t.Fatal(err)
+    }
+    body, err := ioutil.ReadAll(resp.Body)
+    resp.Body.Close()
+    if err != io.ErrUnexpectedEOF || string(body) != "0123" {
+        t.Fatalf("got %q, %v", body, err)
+    }
+
+    client := &http.Client{Timeout: 50 * time.Millisecond}
+    if _, err := client.Get(srv.URL + "/slow"); err == nil {
+        t.Fatal("delayed response arrived before the timeout")
+    }
+}
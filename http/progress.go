@@ -0,0 +1,215 @@
+package http
+
+import (
+    "context"
+    "io"
+    "sync"
+    "time"
+)
+
+// Direction 传输方向
+type Direction int
+
+const (
+    Upload Direction = iota
+    Download
+)
+
+func (d Direction) String() string {
+    if d == Upload {
+        return "upload"
+    }
+    return "download"
+}
+
+// Progress 传输进度
+// Direction 传输方向，Upload 为请求体，Download 为响应体
+// Done      已传输字节数
+// Total     总字节数，未知时为 -1
+// Rate      平均传输速率，单位 字节/秒
+// Elapsed   从开始传输到现在的时间
+type Progress struct {
+    Direction Direction
+    Done      int64
+    Total     int64
+    Rate      float64
+    Elapsed   time.Duration
+}
+
+// progressInterval is the minimum interval between two progress callbacks of one body.
+const progressInterval = 100 * time.Millisecond
+
+// SetProgress sets the callback reporting the progress of the request body and the response body,
+// it is called at most every 100ms and once more when a body is finished.
+func (h *HttpClient) SetProgress(fn func(p Progress)) *HttpClient {
+    h.progress = fn
+
+    return h
+}
+
+// SetBandwidth limits the upload and download speed of this request in bytes per second, 0 removes the limit.
+func (h *HttpClient) SetBandwidth(bytesPerSecond int64) *HttpClient {
+    if bytesPerSecond <= 0 {
+        h.bandwidth = nil
+    } else {
+        h.bandwidth = NewBandwidthLimiter(bytesPerSecond)
+    }
+
+    return h
+}
+
+// SetBandwidthLimiter shares a limiter between clients, e.g. to cap the total speed of a batch job.
+// It applies on top of SetBandwidth.
+func (h *HttpClient) SetBandwidthLimiter(limiter *BandwidthLimiter) *HttpClient {
+    h.sharedBandwidth = limiter
+
+    return h
+}
+
+// BandwidthLimiter is a token bucket of bytes, it is safe for concurrent use.
+type BandwidthLimiter struct {
+    mu     sync.Mutex
+    rate   float64
+    burst  int
+    tokens float64
+    last   time.Time
+}
+
+// NewBandwidthLimiter limits the speed to bytesPerSecond, allowing bursts of one second of traffic.
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+    burst := int(bytesPerSecond)
+    if burst < 1 {
+        burst = 1
+    }
+    return &BandwidthLimiter{
+        rate:   float64(bytesPerSecond),
+        burst:  burst,
+        tokens: float64(burst),
+        last:   time.Now(),
+    }
+}
+
+// wait blocks until n bytes may be transferred or ctx is done.
+func (l *BandwidthLimiter) wait(ctx context.Context, n int) error {
+    l.mu.Lock()
+    now := time.Now()
+    l.tokens += now.Sub(l.last).Seconds() * l.rate
+    if l.tokens > float64(l.burst) {
+        l.tokens = float64(l.burst)
+    }
+    l.last = now
+    l.tokens -= float64(n)
+    var delay time.Duration
+    if l.tokens < 0 {
+        delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+    }
+    l.mu.Unlock()
+    if delay <= 0 {
+        return nil
+    }
+    t := time.NewTimer(delay)
+    defer t.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-t.C:
+        return nil
+    }
+}
+
+// wrapBody adds progress reporting and bandwidth limits to a request or response body.
+func (h *HttpClient) wrapBody(body io.ReadCloser, direction Direction, total int64) io.ReadCloser {
+    if body == nil || (h.progress == nil && h.bandwidth == nil && h.sharedBandwidth == nil) {
+        return body
+    }
+    if total <= 0 {
+        total = -1
+    }
+    var limiters []*BandwidthLimiter
+    for _, l := range []*BandwidthLimiter{h.bandwidth, h.sharedBandwidth} {
+        if l != nil {
+            limiters = append(limiters, l)
+        }
+    }
+    return &progressBody{
+        ReadCloser: body,
+        ctx:        h.ctx,
+        fn:         h.progress,
+        limiters:   limiters,
+        direction:  direction,
+        total:      total,
+        start:      time.Now(),
+    }
+}
+
+// progressBody reports the progress of body, Close may be called by the transport while Read is running.
+type progressBody struct {
+    io.ReadCloser
+    ctx       context.Context
+    fn        func(p Progress)
+    limiters  []*BandwidthLimiter
+    direction Direction
+    total     int64
+    mu        sync.Mutex // 保护 done、reported、finished
+    done      int64
+    start     time.Time
+    reported  time.Time
+    finished  bool
+}
+
+func (b *progressBody) Read(p []byte) (int, error) {
+    // 单次读取不超过限速器的桶容量，避免一次等待过久
+    for _, l := range b.limiters {
+        if len(p) > l.burst {
+            p = p[:l.burst]
+        }
+    }
+    n, err := b.ReadCloser.Read(p)
+    if n > 0 {
+        for _, l := range b.limiters {
+            if er := l.wait(b.ctx, n); er != nil && err == nil {
+                err = er
+            }
+        }
+        b.mu.Lock()
+        b.done += int64(n)
+        b.mu.Unlock()
+    }
+    b.report(err != nil)
+    return n, err
+}
+
+func (b *progressBody) Close() error {
+    b.report(true)
+    return b.ReadCloser.Close()
+}
+
+func (b *progressBody) report(final bool) {
+    if b.fn == nil {
+        return
+    }
+    // 回调在锁内执行，保证进度按顺序上报且最终进度只上报一次
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if b.finished {
+        return
+    }
+    now := time.Now()
+    if !final && now.Sub(b.reported) < progressInterval {
+        return
+    }
+    b.reported = now
+    b.finished = final
+    elapsed := now.Sub(b.start)
+    var rate float64
+    if elapsed > 0 {
+        rate = float64(b.done) / elapsed.Seconds()
+    }
+    b.fn(Progress{
+        Direction: b.direction,
+        Done:      b.done,
+        Total:     b.total,
+        Rate:      rate,
+        Elapsed:   elapsed,
+    })
+}
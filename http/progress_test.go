@@ -0,0 +1,154 @@
+package http
+
+import (
+    "bytes"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "sync"
+    "testing"
+    "time"
+)
+
+// progressRecorder collects the progress callbacks.
+type progressRecorder struct {
+    mu   sync.Mutex
+    list []Progress
+}
+
+func (r *progressRecorder) record(p Progress) {
+    r.mu.Lock()
+    r.list = append(r.list, p)
+    r.mu.Unlock()
+}
+
+func (r *progressRecorder) last(direction Direction) (Progress, int) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    var (
+        last Progress
+        n    int
+    )
+    for _, p := range r.list {
+        if p.Direction == direction {
+            last, n = p, n+1
+        }
+    }
+    return last, n
+}
+
+func TestProgress(t *testing.T) {
+    payload := bytes.Repeat([]byte("x"), 256<<10)
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ioutil.ReadAll(r.Body)
+        w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+        w.Write(payload)
+    }))
+    defer srv.Close()
+
+    rec := &progressRecorder{}
+    h, _ := NewHttpClient(nil, srv.URL, http.MethodPost, nil)
+    body, err := h.Body(payload[:1000]).SetProgress(rec.record).Bytes()
+    if err != nil || len(body) != len(payload) {
+        t.Fatalf("got %d bytes, %v", len(body), err)
+    }
+    up, _ := rec.last(Upload)
+    if up.Done != 1000 || up.Total != 1000 {
+        t.Fatalf("upload progress %+v", up)
+    }
+    down, _ := rec.last(Download)
+    if down.Done != int64(len(payload)) || down.Total != int64(len(payload)) || down.Elapsed <= 0 || down.Rate <= 0 {
+        t.Fatalf("download progress %+v", down)
+    }
+}
+
+func TestProgressFinalOnce(t *testing.T) {
+    rec := &progressRecorder{}
+    h, _ := Get("http://example.com")
+    h.SetProgress(rec.record)
+    b := h.wrapBody(ioutil.NopCloser(bytes.NewReader(make([]byte, 10))), Download, 10)
+    ioutil.ReadAll(b)
+    _, before := rec.last(Download)
+    b.Close()
+    if _, after := rec.last(Download); after != before {
+        t.Fatalf("Close reported again: %d callbacks, then %d", before, after)
+    }
+}
+
+func TestProgressConcurrentClose(t *testing.T) {
+    // transport 可能在读取请求体的同时关闭它，用 -race 检查
+    rec := &progressRecorder{}
+    h, _ := Get("http://example.com")
+    h.SetProgress(rec.record)
+    pr, pw := io.Pipe()
+    b := h.wrapBody(pr, Upload, -1)
+    go func() {
+        for i := 0; i < 100; i++ {
+            pw.Write([]byte("chunk"))
+        }
+        pw.Close()
+    }()
+    done := make(chan struct{})
+    go func() {
+        io.Copy(ioutil.Discard, b)
+        close(done)
+    }()
+    time.Sleep(time.Millisecond)
+    b.Close()
+    <-done
+    rec.mu.Lock()
+    defer rec.mu.Unlock()
+    for i := 1; i < len(rec.list); i++ {
+        if rec.list[i].Done < rec.list[i-1].Done {
+            t.Fatalf("progress went back from %d to %d", rec.list[i-1].Done, rec.list[i].Done)
+        }
+    }
+}
+
+func TestBandwidth(t *testing.T) {
+    payload := bytes.Repeat([]byte("x"), 150<<10)
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write(payload)
+    }))
+    defer srv.Close()
+
+    // 第一秒的突发之后，剩下的 50KB 需要 0.5s
+    start := time.Now()
+    h, _ := Get(srv.URL)
+    body, err := h.SetBandwidth(100 << 10).Bytes()
+    if err != nil || len(body) != len(payload) {
+        t.Fatalf("got %d bytes, %v", len(body), err)
+    }
+    if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+        t.Fatalf("150KB at 100KB/s took %s", elapsed)
+    }
+}
+
+func TestBandwidthLimiterShared(t *testing.T) {
+    payload := bytes.Repeat([]byte("x"), 60<<10)
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write(payload)
+    }))
+    defer srv.Close()
+
+    // 两个请求共用 100KB/s，一共 120KB
+    limiter := NewBandwidthLimiter(100 << 10)
+    start := time.Now()
+    var wg sync.WaitGroup
+    for i := 0; i < 2; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            h, _ := Get(srv.URL)
+            if _, err := h.SetBandwidthLimiter(limiter).Bytes(); err != nil {
+                t.Error(err)
+            }
+        }()
+    }
+    wg.Wait()
+    if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+        t.Fatalf("120KB at a shared 100KB/s took %s", elapsed)
+    }
+}
@@ -0,0 +1,301 @@
+package http
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// proxyServer is an HTTP proxy counting its connections and proxied requests.
+type proxyServer struct {
+    *httptest.Server
+    conns, proxied int32
+}
+
+func newProxyServer() *proxyServer {
+    p := &proxyServer{}
+    p.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.IsAbs() {
+            atomic.AddInt32(&p.proxied, 1)
+        }
+        w.Write([]byte("via proxy"))
+    }))
+    p.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+        if state == http.StateNew {
+            atomic.AddInt32(&p.conns, 1)
+        }
+    }
+    p.Start()
+    return p
+}
+
+func TestSetProxyReusesConnections(t *testing.T) {
+    tests := []struct {
+        name  string
+        new   func() *HttpClient
+        conns int32
+    }{
+        {"default transport", func() *HttpClient {
+            h, _ := NewHttpClient(nil, "http://example.invalid/", http.MethodGet, nil)
+            return h
+        }, 1},
+        {"proxy transport", func() func() *HttpClient {
+            trans := NewProxyTransport(&http.Transport{}, nil)
+            return func() *HttpClient {
+                h, _ := NewHttpClient(nil, "http://example.invalid/", http.MethodGet, trans)
+                return h
+            }
+        }(), 1},
+        {"client", func() func() *HttpClient {
+            c := NewClient("http://example.invalid", &http.Transport{})
+            return func() *HttpClient {
+                h, _ := c.R().Get("/")
+                return h
+            }
+        }(), 1},
+        // 只属于一个请求的 transport 不保留连接
+        {"one-off transport", func() *HttpClient {
+            h, _ := NewHttpClient(nil, "http://example.invalid/", http.MethodGet, &http.Transport{})
+            return h
+        }, 3},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            proxy := newProxyServer()
+            defer proxy.Close()
+            for i := 0; i < 3; i++ {
+                if _, err := tt.new().SetProxy(proxy.URL).Bytes(); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            if atomic.LoadInt32(&proxy.proxied) != 3 || atomic.LoadInt32(&proxy.conns) != tt.conns {
+                t.Fatalf("%d proxied requests over %d connections, want %d", proxy.proxied, proxy.conns, tt.conns)
+            }
+        })
+    }
+}
+
+func TestNoProxyMatch(t *testing.T) {
+    n := ParseNoProxy("example.com, .internal, 10.0.0.0/8, 192.168.1.1, localhost:8080, [::1]")
+    tests := []struct {
+        host  string
+        match bool
+    }{
+        {"example.com", true},
+        {"api.example.com:443", true},
+        {"badexample.com", false},
+        {"internal", false},
+        {"db.internal", true},
+        {"10.1.2.3:80", true},
+        {"11.0.0.1", false},
+        {"192.168.1.1", true},
+        {"localhost:8080", true},
+        {"localhost:9090", false},
+        {"[::1]:80", true},
+    }
+    for _, tt := range tests {
+        if n.Match(tt.host) != tt.match {
+            t.Errorf("Match(%q) = %v", tt.host, !tt.match)
+        }
+    }
+    if !ParseNoProxy("*").Match("any.host") || (*NoProxy)(nil).Match("a.com") {
+        t.Fatal("* or nil NoProxy")
+    }
+}
+
+func TestClientNoProxy(t *testing.T) {
+    var direct int32
+    target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(&direct, 1)
+    }))
+    defer target.Close()
+    proxy := newProxyServer()
+    defer proxy.Close()
+
+    c := NewClient(target.URL, nil).SetProxy(proxy.URL).SetNoProxy("127.0.0.1")
+    h, _ := c.R().Get("/")
+    if _, err := h.Bytes(); err != nil {
+        t.Fatal(err)
+    }
+    h, _ = c.R().Get("http://example.invalid/")
+    if body, err := h.Bytes(); err != nil || string(body) != "via proxy" {
+        t.Fatalf("got %q, %v", body, err)
+    }
+    if atomic.LoadInt32(&direct) != 1 || atomic.LoadInt32(&proxy.proxied) != 1 {
+        t.Fatalf("%d direct, %d proxied requests", direct, proxy.proxied)
+    }
+}
+
+func TestProxyPool(t *testing.T) {
+    live := newProxyServer()
+    defer live.Close()
+    // 关闭的端口，连接会被拒绝
+    l, _ := net.Listen("tcp", "127.0.0.1:0")
+    dead := "http://" + l.Addr().String()
+    l.Close()
+
+    pool, err := NewProxyPool(dead, live.URL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    pool.SetMaxFailures(1).SetCooldown(time.Hour)
+    c := NewClient("http://example.invalid", nil).SetProxySelector(pool)
+    var failures int
+    for i := 0; i < 4; i++ {
+        h, _ := c.R().Get("/")
+        if _, err := h.Bytes(); err != nil {
+            failures++
+        }
+    }
+    if failures != 1 || atomic.LoadInt32(&live.proxied) != 3 {
+        t.Fatalf("%d failures, %d requests through the live proxy", failures, live.proxied)
+    }
+    if healthy := pool.Healthy(); len(healthy) != 1 || healthy[0] != live.URL {
+        t.Fatalf("Healthy() = %v", healthy)
+    }
+
+    pool, _ = NewProxyPool(dead)
+    pool.SetMaxFailures(1)
+    c = NewClient("http://example.invalid", nil).SetProxySelector(pool)
+    h, _ := c.R().Get("/")
+    h.Bytes()
+    h, _ = c.R().Get("/")
+    if _, err := h.Bytes(); !errors.Is(err, ErrNoProxyAvailable) {
+        t.Fatalf("got %v", err)
+    }
+}
+
+// socks5Server is a SOCKS5 proxy recording the requested addresses, domains resolve to target.
+type socks5Server struct {
+    net.Listener
+    user, pass string
+    target     string
+    mu         sync.Mutex
+    requested  []string
+}
+
+func newSOCKS5Server(t *testing.T, user, pass, target string) *socks5Server {
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    s := &socks5Server{Listener: l, user: user, pass: pass, target: target}
+    go func() {
+        for {
+            conn, err := l.Accept()
+            if err != nil {
+                return
+            }
+            go s.serve(conn)
+        }
+    }()
+    return s
+}
+
+func (s *socks5Server) serve(conn net.Conn) {
+    defer conn.Close()
+    buf := make([]byte, 262)
+    if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+        return
+    }
+    io.ReadFull(conn, buf[:buf[1]])
+    if s.user == "" {
+        conn.Write([]byte{5, 0})
+    } else {
+        conn.Write([]byte{5, 2})
+        io.ReadFull(conn, buf[:2])
+        user := make([]byte, buf[1])
+        io.ReadFull(conn, user)
+        io.ReadFull(conn, buf[:1])
+        pass := make([]byte, buf[0])
+        io.ReadFull(conn, pass)
+        if string(user) != s.user || string(pass) != s.pass {
+            conn.Write([]byte{1, 1})
+            return
+        }
+        conn.Write([]byte{1, 0})
+    }
+    io.ReadFull(conn, buf[:4])
+    var host string
+    switch buf[3] {
+    case 1:
+        io.ReadFull(conn, buf[:4])
+        host = net.IP(buf[:4]).String()
+    case 3:
+        io.ReadFull(conn, buf[:1])
+        name := make([]byte, buf[0])
+        io.ReadFull(conn, name)
+        host = string(name)
+    case 4:
+        io.ReadFull(conn, buf[:16])
+        host = net.IP(buf[:16]).String()
+    }
+    io.ReadFull(conn, buf[:2])
+    addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2]))))
+    s.mu.Lock()
+    s.requested = append(s.requested, addr)
+    s.mu.Unlock()
+
+    upstream, err := net.Dial("tcp", s.target)
+    if err != nil {
+        conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+        return
+    }
+    defer upstream.Close()
+    conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+    go io.Copy(upstream, conn)
+    io.Copy(conn, upstream)
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+    target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte("hello " + r.Host))
+    }))
+    defer target.Close()
+    _, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+
+    tests := []struct {
+        scheme, user, pass, host, requested string
+    }{
+        // socks5h 由代理解析域名
+        {"socks5h", "tom", "secret", "target.test", "target.test:" + port},
+        {"socks5", "", "", "127.0.0.1", "127.0.0.1:" + port},
+    }
+    for _, tt := range tests {
+        t.Run(tt.scheme, func(t *testing.T) {
+            s := newSOCKS5Server(t, tt.user, tt.pass, target.Listener.Addr().String())
+            defer s.Close()
+            proxy := tt.scheme + "://" + s.Addr().String()
+            if tt.user != "" {
+                proxy = tt.scheme + "://" + tt.user + ":" + tt.pass + "@" + s.Addr().String()
+            }
+            c := NewClient("", nil).SetProxy(proxy)
+            h, _ := c.R().Get(fmt.Sprintf("http://%s:%s/", tt.host, port))
+            body, err := h.Bytes()
+            if err != nil || string(body) != "hello "+tt.host+":"+port {
+                t.Fatalf("got %q, %v", body, err)
+            }
+            s.mu.Lock()
+            defer s.mu.Unlock()
+            if len(s.requested) != 1 || s.requested[0] != tt.requested {
+                t.Fatalf("proxy asked for %v, want %s", s.requested, tt.requested)
+            }
+        })
+    }
+
+    s := newSOCKS5Server(t, "tom", "secret", target.Listener.Addr().String())
+    defer s.Close()
+    h, _ := Get(target.URL)
+    if _, err := h.SetProxy("socks5://tom:wrong@" + s.Addr().String()).Bytes(); err == nil {
+        t.Fatal("wrong socks5 password accepted")
+    }
+}
@@ -0,0 +1,263 @@
+package http
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "path"
+    "strings"
+    "sync"
+    "time"
+)
+
+// ErrRateLimited is matched by errors.Is for every request rejected by a RateLimiter.
+var ErrRateLimited = errors.New("http: rate limited")
+
+// RateLimitError is returned when a request exceeds a rate limit in fail-fast mode,
+// or when waiting for a token would outlast the deadline of the request context.
+type RateLimitError struct {
+    Limit      string // 触发限流的规则：global、host 或者路由规则
+    RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+    return fmt.Sprintf("http: rate limit %s exceeded, retry after %s", e.Limit, e.RetryAfter)
+}
+
+func (e *RateLimitError) Is(target error) bool {
+    return target == ErrRateLimited
+}
+
+// RateLimiter holds token buckets shared by the requests using it: one global bucket, one bucket per host
+// and one per route pattern. A request takes a token from every bucket it matches.
+// By default a request waits for its tokens, bounded by its context; SetFailFast returns a *RateLimitError instead.
+// A rate of zero or less means no limit.
+//     limiter := uHttp.NewRateLimiter().SetGlobal(100, 10).SetPerHost(20, 5).
+//         SetRoute("api.example.com/v1/orders/*", 5, 1)
+type RateLimiter struct {
+    mu       sync.Mutex
+    failFast bool
+    global   *tokenBucket
+    perHost  *rateLimit
+    hostRate map[string]rateLimit
+    hosts    map[string]*tokenBucket
+    routes   []*routeBucket
+}
+
+type rateLimit struct {
+    rate  float64
+    burst int
+}
+
+type routeBucket struct {
+    method  string
+    pattern string
+    bucket  *tokenBucket
+}
+
+func NewRateLimiter() *RateLimiter {
+    return &RateLimiter{
+        hostRate: make(map[string]rateLimit),
+        hosts:    make(map[string]*tokenBucket),
+    }
+}
+
+// SetGlobal limits all requests to rate per second with bursts of burst requests.
+func (l *RateLimiter) SetGlobal(rate float64, burst int) *RateLimiter {
+    l.mu.Lock()
+    l.global = newTokenBucket(rate, burst)
+    l.mu.Unlock()
+
+    return l
+}
+
+// SetPerHost limits the requests of every host to rate per second, each host has its own bucket.
+func (l *RateLimiter) SetPerHost(rate float64, burst int) *RateLimiter {
+    l.mu.Lock()
+    l.perHost = &rateLimit{rate: rate, burst: burst}
+    l.hosts = make(map[string]*tokenBucket)
+    l.mu.Unlock()
+
+    return l
+}
+
+// SetHost limits the requests of host, it overrides SetPerHost for that host.
+func (l *RateLimiter) SetHost(host string, rate float64, burst int) *RateLimiter {
+    l.mu.Lock()
+    l.hostRate[host] = rateLimit{rate: rate, burst: burst}
+    delete(l.hosts, host)
+    l.mu.Unlock()
+
+    return l
+}
+
+// SetRoute limits the requests matching pattern, which is host and path matched by path.Match,
+// optionally preceded by a method: "POST api.example.com/v1/orders/*". All matching requests share one bucket.
+func (l *RateLimiter) SetRoute(pattern string, rate float64, burst int) *RateLimiter {
+    route := &routeBucket{pattern: pattern, bucket: newTokenBucket(rate, burst)}
+    if i := strings.IndexByte(pattern, ' '); i > 0 {
+        route.method, route.pattern = strings.ToUpper(pattern[:i]), strings.TrimSpace(pattern[i+1:])
+    }
+    l.mu.Lock()
+    l.routes = append(l.routes, route)
+    l.mu.Unlock()
+
+    return l
+}
+
+// SetFailFast makes requests over the limit fail with a *RateLimitError instead of waiting.
+func (l *RateLimiter) SetFailFast(on bool) *RateLimiter {
+    l.mu.Lock()
+    l.failFast = on
+    l.mu.Unlock()
+
+    return l
+}
+
+// Wait takes a token for req from every matching bucket, waiting for them unless the limiter fails fast.
+func (l *RateLimiter) Wait(ctx context.Context, req *http.Request) error {
+    now := time.Now()
+    l.mu.Lock()
+    buckets, names := l.buckets(req)
+    var (
+        delay time.Duration
+        limit string
+    )
+    for i, b := range buckets {
+        b.advance(now)
+        if d := b.delay(); d > delay {
+            delay, limit = d, names[i]
+        }
+    }
+    if delay > 0 && l.failFast {
+        l.mu.Unlock()
+        return &RateLimitError{Limit: limit, RetryAfter: delay}
+    }
+    if deadline, ok := ctx.Deadline(); ok && delay > 0 && deadline.Before(now.Add(delay)) {
+        l.mu.Unlock()
+        return &RateLimitError{Limit: limit, RetryAfter: delay}
+    }
+    // 先扣减令牌再等待，保证等待中的请求按顺序获得令牌
+    for _, b := range buckets {
+        b.tokens--
+    }
+    l.mu.Unlock()
+    if delay <= 0 {
+        return nil
+    }
+    t := time.NewTimer(delay)
+    defer t.Stop()
+    select {
+    case <-ctx.Done():
+        l.mu.Lock()
+        for _, b := range buckets {
+            b.refund()
+        }
+        l.mu.Unlock()
+        return ctx.Err()
+    case <-t.C:
+        return nil
+    }
+}
+
+// buckets returns the buckets matching req with their names, the caller holds l.mu.
+func (l *RateLimiter) buckets(req *http.Request) ([]*tokenBucket, []string) {
+    var (
+        buckets []*tokenBucket
+        names   []string
+    )
+    add := func(b *tokenBucket, name string) {
+        // 不限速的规则没有令牌桶
+        if b != nil {
+            buckets, names = append(buckets, b), append(names, name)
+        }
+    }
+    add(l.global, "global")
+    host := req.URL.Host
+    b, ok := l.hosts[host]
+    if !ok {
+        if r, found := l.hostRate[host]; found {
+            b, ok = newTokenBucket(r.rate, r.burst), true
+        } else if l.perHost != nil {
+            b, ok = newTokenBucket(l.perHost.rate, l.perHost.burst), true
+        }
+        if ok {
+            l.hosts[host] = b
+        }
+    }
+    add(b, "host "+host)
+    target := host + req.URL.EscapedPath()
+    for _, r := range l.routes {
+        if r.method != "" && r.method != req.Method {
+            continue
+        }
+        if ok, _ := path.Match(r.pattern, target); ok {
+            add(r.bucket, "route "+r.pattern)
+        }
+    }
+    return buckets, names
+}
+
+// tokenBucket counts requests, tokens goes negative while requests wait for their turn.
+type tokenBucket struct {
+    rate   float64
+    burst  float64
+    tokens float64
+    last   time.Time
+}
+
+// newTokenBucket returns nil when rate is not positive, which means no limit.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+    if rate <= 0 {
+        return nil
+    }
+    if burst < 1 {
+        burst = 1
+    }
+    return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (b *tokenBucket) advance(now time.Time) {
+    if now.After(b.last) {
+        b.tokens += now.Sub(b.last).Seconds() * b.rate
+        b.last = now
+    }
+    if b.tokens > b.burst {
+        b.tokens = b.burst
+    }
+}
+
+// delay is how long until a token is available.
+func (b *tokenBucket) delay() time.Duration {
+    if b.tokens >= 1 {
+        return 0
+    }
+    return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) refund() {
+    b.tokens++
+    if b.tokens > b.burst {
+        b.tokens = b.burst
+    }
+}
+
+// SetRateLimiter makes every attempt of the request take a token from limiter, responses served
+// from the cache do not count. The request is authenticated and signed after it gets its token.
+func (h *HttpClient) SetRateLimiter(limiter *RateLimiter) *HttpClient {
+    h.rateLimiter = limiter
+
+    return h
+}
+
+func rateLimitInterceptor(limiter *RateLimiter) Interceptor {
+    return func(next Doer) Doer {
+        return DoerFunc(func(req *http.Request) (*http.Response, error) {
+            if err := limiter.Wait(req.Context(), req); err != nil {
+                return nil, err
+            }
+            return next.Do(req)
+        })
+    }
+}
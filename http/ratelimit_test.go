@@ -0,0 +1,136 @@
+package http
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+)
+
+func limitRequest(method, rawURL string) *http.Request {
+    req, _ := http.NewRequest(method, rawURL, nil)
+    return req
+}
+
+func TestRateLimiterWait(t *testing.T) {
+    l := NewRateLimiter().SetGlobal(20, 2)
+    req := limitRequest("GET", "http://a.com/")
+    start := time.Now()
+    for i := 0; i < 3; i++ {
+        if err := l.Wait(context.Background(), req); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // 突发的两个请求不等待，第三个请求等待一个令牌
+    if elapsed := time.Since(start); elapsed < 40*time.Millisecond || elapsed > 500*time.Millisecond {
+        t.Fatalf("three requests took %s", elapsed)
+    }
+}
+
+func TestRateLimiterFailFast(t *testing.T) {
+    l := NewRateLimiter().SetGlobal(1, 1).SetFailFast(true)
+    req := limitRequest("GET", "http://a.com/")
+    if err := l.Wait(context.Background(), req); err != nil {
+        t.Fatal(err)
+    }
+    err := l.Wait(context.Background(), req)
+    var rle *RateLimitError
+    if !errors.Is(err, ErrRateLimited) || !errors.As(err, &rle) || rle.Limit != "global" || rle.RetryAfter <= 0 {
+        t.Fatalf("got %v", err)
+    }
+}
+
+func TestRateLimiterDeadline(t *testing.T) {
+    l := NewRateLimiter().SetGlobal(1, 1)
+    req := limitRequest("GET", "http://a.com/")
+    l.Wait(context.Background(), req)
+    ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+    defer cancel()
+    start := time.Now()
+    if err := l.Wait(ctx, req); !errors.Is(err, ErrRateLimited) {
+        t.Fatalf("got %v", err)
+    }
+    // 等不到令牌的请求立即失败
+    if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+        t.Fatalf("failed after %s", elapsed)
+    }
+}
+
+func TestRateLimiterNoLimit(t *testing.T) {
+    l := NewRateLimiter().SetGlobal(0, 1).SetPerHost(-1, 1).SetRoute("a.com/*", 0, 0).SetFailFast(true)
+    req := limitRequest("GET", "http://a.com/x")
+    for i := 0; i < 100; i++ {
+        if err := l.Wait(context.Background(), req); err != nil {
+            t.Fatal(err)
+        }
+    }
+}
+
+func TestRateLimiterHostsAndRoutes(t *testing.T) {
+    l := NewRateLimiter().
+        SetPerHost(1, 1).
+        SetHost("free.com", 0, 0).
+        SetRoute("POST api.com/v1/orders/*", 1, 1).
+        SetFailFast(true)
+    tests := []struct {
+        method, url string
+        limited     bool
+    }{
+        {"GET", "http://a.com/", false},
+        {"GET", "http://b.com/", false},
+        {"GET", "http://a.com/", true},
+        {"GET", "http://free.com/", false},
+        {"GET", "http://free.com/", false},
+        {"POST", "http://api.com/v1/orders/1", false},
+        // api.com 的主机令牌已经用完
+        {"GET", "http://api.com/v1/orders/1", true},
+    }
+    for _, tt := range tests {
+        err := l.Wait(context.Background(), limitRequest(tt.method, tt.url))
+        if errors.Is(err, ErrRateLimited) != tt.limited {
+            t.Fatalf("%s %s: got %v", tt.method, tt.url, err)
+        }
+    }
+
+    l = NewRateLimiter().SetRoute("POST api.com/v1/orders/*", 1, 1).SetFailFast(true)
+    l.Wait(context.Background(), limitRequest("POST", "http://api.com/v1/orders/1"))
+    if err := l.Wait(context.Background(), limitRequest("POST", "http://api.com/v1/orders/2")); !errors.Is(err, ErrRateLimited) {
+        t.Fatalf("route not limited: %v", err)
+    }
+    if err := l.Wait(context.Background(), limitRequest("GET", "http://api.com/v1/orders/2")); err != nil {
+        t.Fatalf("GET matched a POST route: %v", err)
+    }
+}
+
+// timeAuth records when every request is authenticated.
+type timeAuth struct {
+    mu    sync.Mutex
+    times []time.Time
+}
+
+func (a *timeAuth) Authenticate(req *http.Request) error {
+    a.mu.Lock()
+    a.times = append(a.times, time.Now())
+    a.mu.Unlock()
+    return nil
+}
+
+func TestRateLimiterAuthenticatesAfterWait(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    defer srv.Close()
+
+    limiter := NewRateLimiter().SetGlobal(10, 1)
+    auth := &timeAuth{}
+    for i := 0; i < 2; i++ {
+        h, _ := Get(srv.URL)
+        if _, err := h.SetRateLimiter(limiter).SetAuth(auth).Bytes(); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if gap := auth.times[1].Sub(auth.times[0]); gap < 80*time.Millisecond {
+        t.Fatalf("second request authenticated %s after the first, before its token", gap)
+    }
+}
@@ -0,0 +1,372 @@
+package http
+
+import (
+    "bytes"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    "unicode/utf8"
+
+    "gopkg.in/yaml.v2"
+)
+
+type RecordMode int
+
+const (
+    // ModeReplay serves every request from the cassette and fails the requests it has not recorded
+    ModeReplay RecordMode = iota
+    // ModeRecord sends every request and records it into a new cassette
+    ModeRecord
+    // ModeReplayOrRecord serves the recorded requests and records the others
+    ModeReplayOrRecord
+)
+
+// ErrInteractionNotFound is returned in replay mode for a request missing from the cassette.
+var ErrInteractionNotFound = errors.New("http: no recorded interaction matches the request")
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+    Request  RecordedRequest  `json:"request" yaml:"request"`
+    Response RecordedResponse `json:"response" yaml:"response"`
+}
+
+type RecordedRequest struct {
+    Method       string      `json:"method" yaml:"method"`
+    URL          string      `json:"url" yaml:"url"`
+    Header       http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+    Body         string      `json:"body,omitempty" yaml:"body,omitempty"`
+    BodyEncoding string      `json:"body_encoding,omitempty" yaml:"body_encoding,omitempty"` // 二进制内容为 base64
+}
+
+type RecordedResponse struct {
+    Status       string        `json:"status" yaml:"status"`
+    StatusCode   int           `json:"status_code" yaml:"status_code"`
+    Header       http.Header   `json:"header,omitempty" yaml:"header,omitempty"`
+    Body         string        `json:"body,omitempty" yaml:"body,omitempty"`
+    BodyEncoding string        `json:"body_encoding,omitempty" yaml:"body_encoding,omitempty"`
+    Duration     time.Duration `json:"duration" yaml:"duration"`
+}
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+    Interactions []*Interaction `json:"interactions" yaml:"interactions"`
+}
+
+// Matcher reports whether a live request matches a recorded one, both scrubbed the same way.
+type Matcher func(live, recorded *RecordedRequest) bool
+
+func MatchMethod(live, recorded *RecordedRequest) bool {
+    return live.Method == recorded.Method
+}
+
+func MatchURL(live, recorded *RecordedRequest) bool {
+    return live.URL == recorded.URL
+}
+
+func MatchBody(live, recorded *RecordedRequest) bool {
+    return live.Body == recorded.Body
+}
+
+// MatchHeaders matches the values of the given headers.
+func MatchHeaders(names ...string) Matcher {
+    return func(live, recorded *RecordedRequest) bool {
+        for _, name := range names {
+            if strings.Join(live.Header.Values(name), ",") != strings.Join(recorded.Header.Values(name), ",") {
+                return false
+            }
+        }
+        return true
+    }
+}
+
+// RecorderConfig 录制回放配置
+// Mode         录制或者回放模式，默认 ModeReplay
+// Matchers     匹配请求的规则，默认匹配方法和 URL
+// ScrubHeaders 需要脱敏的请求头、响应头，为空时使用 Authorization、Cookie、Set-Cookie、Proxy-Authorization
+// ScrubQuery   需要脱敏的 URL 参数，如 access_token
+// ScrubFields  需要脱敏的 JSON 字段以及表单字段
+// Scrub        自定义脱敏，保存前对整个交互调用一次，回放匹配前对请求的副本调用
+type RecorderConfig struct {
+    Mode         RecordMode
+    Matchers     []Matcher
+    ScrubHeaders []string
+    ScrubQuery   []string
+    ScrubFields  []string
+    Scrub        func(i *Interaction)
+}
+
+// Recorder is a http.RoundTripper that records interactions into a cassette file and replays them offline.
+// The cassette is YAML when the file name ends with .yaml or .yml, JSON otherwise.
+// Secrets are scrubbed before saving, and live requests are scrubbed the same way before matching.
+//     rec, err := uHttp.NewRecorder("testdata/pay.yaml", uHttp.RecorderConfig{Mode: uHttp.ModeReplayOrRecord}, nil)
+//     h, err := uHttp.NewHttpClient(ctx, url, http.MethodGet, rec)
+type Recorder struct {
+    path     string
+    cfg      RecorderConfig
+    trans    http.RoundTripper
+    patterns []redactPattern
+    mu       sync.Mutex
+    cassette *Cassette
+    used     []bool
+}
+
+// NewRecorder loads the cassette at path unless recording, trans sends the recorded requests,
+// nil uses http.DefaultTransport.
+func NewRecorder(path string, cfg RecorderConfig, trans http.RoundTripper) (*Recorder, error) {
+    if trans == nil {
+        trans = http.DefaultTransport
+    }
+    if len(cfg.Matchers) == 0 {
+        cfg.Matchers = []Matcher{MatchMethod, MatchURL}
+    }
+    if len(cfg.ScrubHeaders) == 0 {
+        cfg.ScrubHeaders = defaultRedactHeaders
+    }
+    r := &Recorder{
+        path:     path,
+        cfg:      cfg,
+        trans:    trans,
+        patterns: redactPatterns(cfg.ScrubFields),
+        cassette: &Cassette{},
+    }
+    if cfg.Mode == ModeRecord {
+        return r, nil
+    }
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        if os.IsNotExist(err) && cfg.Mode == ModeReplayOrRecord {
+            return r, nil
+        }
+        return nil, err
+    }
+    if r.isYAML() {
+        err = yaml.Unmarshal(data, r.cassette)
+    } else {
+        err = json.Unmarshal(data, r.cassette)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("http: load cassette %s: %w", path, err)
+    }
+    r.used = make([]bool, len(r.cassette.Interactions))
+    return r, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+    body, err := requestBody(req)
+    if err != nil {
+        return nil, err
+    }
+    if req.Body != nil {
+        req.Body.Close()
+    }
+    live := &Interaction{Request: RecordedRequest{
+        Method: req.Method,
+        URL:    req.URL.String(),
+        Header: req.Header.Clone(),
+    }}
+    live.Request.Body, live.Request.BodyEncoding = encodeRecordedBody(body)
+    r.scrubRequest(&live.Request)
+
+    if r.cfg.Mode != ModeRecord {
+        if i := r.find(r.matchable(live)); i != nil {
+            return i.Response.response(req)
+        }
+        if r.cfg.Mode == ModeReplay {
+            return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, live.Request.Method, live.Request.URL)
+        }
+    }
+
+    out := req.Clone(req.Context())
+    out.Body = ioutil.NopCloser(bytes.NewReader(body))
+    if body == nil {
+        out.Body = nil
+    }
+    start := time.Now()
+    resp, err := r.trans.RoundTrip(out)
+    if err != nil {
+        return nil, err
+    }
+    respBody, err := ioutil.ReadAll(resp.Body)
+    resp.Body.Close()
+    if err != nil {
+        return nil, err
+    }
+    live.Response = RecordedResponse{
+        Status:     resp.Status,
+        StatusCode: resp.StatusCode,
+        Header:     resp.Header.Clone(),
+        Duration:   time.Since(start),
+    }
+    live.Response.Body, live.Response.BodyEncoding = encodeRecordedBody(respBody)
+    r.scrubResponse(&live.Response)
+    if r.cfg.Scrub != nil {
+        r.cfg.Scrub(live)
+    }
+    if err = r.add(live); err != nil {
+        return nil, err
+    }
+    resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+    return resp, nil
+}
+
+// find returns the first unused matching interaction, or the last matching one when all were used,
+// so that a request sent more times than recorded keeps getting the latest response.
+func (r *Recorder) find(live *RecordedRequest) *Interaction {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    var last *Interaction
+    for i, recorded := range r.cassette.Interactions {
+        if !r.match(live, &recorded.Request) {
+            continue
+        }
+        if !r.used[i] {
+            r.used[i] = true
+            return recorded
+        }
+        last = recorded
+    }
+    return last
+}
+
+func (r *Recorder) match(live, recorded *RecordedRequest) bool {
+    for _, m := range r.cfg.Matchers {
+        if !m(live, recorded) {
+            return false
+        }
+    }
+    return true
+}
+
+func (r *Recorder) add(i *Interaction) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.cassette.Interactions = append(r.cassette.Interactions, i)
+    r.used = append(r.used, true)
+    return r.save()
+}
+
+// save writes the whole cassette after every recorded interaction, the caller holds r.mu.
+func (r *Recorder) save() error {
+    var (
+        data []byte
+        err  error
+    )
+    if r.isYAML() {
+        data, err = yaml.Marshal(r.cassette)
+    } else {
+        data, err = json.MarshalIndent(r.cassette, "", "  ")
+    }
+    if err != nil {
+        return err
+    }
+    if dir := filepath.Dir(r.path); dir != "" {
+        if err = os.MkdirAll(dir, 0755); err != nil {
+            return err
+        }
+    }
+    return ioutil.WriteFile(r.path, data, 0644)
+}
+
+func (r *Recorder) isYAML() bool {
+    ext := strings.ToLower(filepath.Ext(r.path))
+    return ext == ".yaml" || ext == ".yml"
+}
+
+// Cassette returns the interactions loaded or recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return &Cassette{Interactions: append([]*Interaction(nil), r.cassette.Interactions...)}
+}
+
+// matchable returns the live request as it would be saved, the custom Scrub runs on a copy
+// so that the interaction recorded on a miss is scrubbed only once.
+func (r *Recorder) matchable(live *Interaction) *RecordedRequest {
+    if r.cfg.Scrub == nil {
+        return &live.Request
+    }
+    i := &Interaction{Request: live.Request}
+    i.Request.Header = live.Request.Header.Clone()
+    r.cfg.Scrub(i)
+    return &i.Request
+}
+
+func (r *Recorder) scrubRequest(req *RecordedRequest) {
+    r.scrubHeader(req.Header)
+    if len(r.cfg.ScrubQuery) > 0 {
+        if u, err := url.Parse(req.URL); err == nil {
+            query := u.Query()
+            for _, name := range r.cfg.ScrubQuery {
+                if _, ok := query[name]; ok {
+                    query.Set(name, redacted)
+                }
+            }
+            u.RawQuery = query.Encode()
+            req.URL = u.String()
+        }
+    }
+    if len(r.patterns) > 0 && req.BodyEncoding == "" {
+        req.Body = redactBody([]byte(req.Body), r.patterns)
+    }
+}
+
+func (r *Recorder) scrubResponse(resp *RecordedResponse) {
+    r.scrubHeader(resp.Header)
+    if len(r.patterns) > 0 && resp.BodyEncoding == "" {
+        resp.Body = redactBody([]byte(resp.Body), r.patterns)
+    }
+}
+
+func (r *Recorder) scrubHeader(header http.Header) {
+    for _, name := range r.cfg.ScrubHeaders {
+        if _, ok := header[http.CanonicalHeaderKey(name)]; ok {
+            header.Set(name, redacted)
+        }
+    }
+}
+
+func encodeRecordedBody(body []byte) (string, string) {
+    if utf8.Valid(body) {
+        return string(body), ""
+    }
+    return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func (rr *RecordedResponse) response(req *http.Request) (*http.Response, error) {
+    body := []byte(rr.Body)
+    if rr.BodyEncoding == "base64" {
+        var err error
+        if body, err = base64.StdEncoding.DecodeString(rr.Body); err != nil {
+            return nil, err
+        }
+    }
+    header := rr.Header.Clone()
+    if header == nil {
+        header = make(http.Header)
+    }
+    // 脱敏后长度可能变化
+    if header.Get("Content-Length") != "" {
+        header.Set("Content-Length", strconv.Itoa(len(body)))
+    }
+    return &http.Response{
+        Status:        rr.Status,
+        StatusCode:    rr.StatusCode,
+        Proto:         "HTTP/1.1",
+        ProtoMajor:    1,
+        ProtoMinor:    1,
+        Header:        header,
+        Body:          ioutil.NopCloser(bytes.NewReader(body)),
+        ContentLength: int64(len(body)),
+        Request:       req,
+    }, nil
+}
@@ -0,0 +1,70 @@
+package http
+
+import (
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestRecorderScrubsOnce(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Set-Cookie", "session=1")
+        w.Write([]byte(`{"token":"abc"}`))
+    }))
+    defer srv.Close()
+
+    path := filepath.Join(t.TempDir(), "cassette.json")
+    // 回放或录制模式未命中时，匹配用的是请求副本，保存的交互仍然只脱敏一次
+    for _, tt := range []struct {
+        name  string
+        mode  RecordMode
+        calls int
+    }{{"record", ModeRecord, 1}, {"replay-or-record", ModeReplayOrRecord, 2}} {
+        var calls int
+        rec, err := NewRecorder(path, RecorderConfig{
+            Mode:        tt.mode,
+            ScrubQuery:  []string{"key"},
+            ScrubFields: []string{"token"},
+            Scrub: func(i *Interaction) {
+                calls++
+                i.Request.Header.Set("X-Scrubbed", i.Request.Header.Get("X-Scrubbed")+"x")
+            },
+        }, nil)
+        if err != nil {
+            t.Fatal(err)
+        }
+        h, _ := NewHttpClient(nil, srv.URL+"?key=secret&mode="+tt.name, http.MethodGet, rec)
+        if body, err := h.Header("Authorization", "Bearer t").Bytes(); err != nil || string(body) != `{"token":"abc"}` {
+            t.Fatalf("got %q, %v", body, err)
+        }
+
+        interactions := rec.Cassette().Interactions
+        i := interactions[len(interactions)-1]
+        if calls != tt.calls || i.Request.Header.Get("X-Scrubbed") != "x" {
+            t.Fatalf("%s: Scrub called %d times, X-Scrubbed %q", tt.name, calls, i.Request.Header.Get("X-Scrubbed"))
+        }
+        if i.Request.Header.Get("Authorization") != redacted || i.Response.Header.Get("Set-Cookie") != redacted ||
+            strings.Contains(i.Request.URL, "secret") || strings.Contains(i.Response.Body, "abc") {
+            t.Fatalf("%s: secrets recorded: %+v", tt.name, i)
+        }
+    }
+
+    data, err := ioutil.ReadFile(path)
+    if err != nil || strings.Contains(string(data), "secret") {
+        t.Fatalf("cassette %s, %v", data, err)
+    }
+    rec, err := NewRecorder(path, RecorderConfig{ScrubQuery: []string{"key"}, Scrub: func(i *Interaction) {
+        i.Request.Header.Set("X-Scrubbed", "x")
+    }}, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    srv.Close()
+    h, _ := NewHttpClient(nil, srv.URL+"?key=other&mode=record", http.MethodGet, rec)
+    if _, err := h.Bytes(); err != nil {
+        t.Fatal(err)
+    }
+}
@@ -0,0 +1,178 @@
+package http
+
+import (
+    "errors"
+    "io"
+    "io/ioutil"
+    "math"
+    "math/rand"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// DefaultRetryStatus 默认需要重试的响应状态码
+var DefaultRetryStatus = []int{
+    http.StatusTooManyRequests,
+    http.StatusBadGateway,
+    http.StatusServiceUnavailable,
+    http.StatusGatewayTimeout,
+}
+
+// DefaultMaxRetryDelay caps the delay between retries of a BackoffPolicy without MaxDelay.
+const DefaultMaxRetryDelay = time.Minute
+
+// RetryPolicy decides whether an attempt should be retried and how long to wait before the next one.
+// resp and err are the result of the attempt, attempt starts from 1.
+type RetryPolicy interface {
+    Retry(req *http.Request, resp *http.Response, err error, attempt int) (bool, time.Duration)
+}
+
+// RetryPolicyFunc adapts an ordinary function to a RetryPolicy.
+type RetryPolicyFunc func(req *http.Request, resp *http.Response, err error, attempt int) (bool, time.Duration)
+
+func (f RetryPolicyFunc) Retry(req *http.Request, resp *http.Response, err error, attempt int) (bool, time.Duration) {
+    return f(req, resp, err, attempt)
+}
+
+// BackoffPolicy retries transport errors and retryable statuses with exponential backoff and jitter.
+// MaxRetries       最多重试次数，-1 表示一直重试直到成功或者 context 结束
+// BaseDelay        第一次重试前的等待时间
+// MaxDelay         等待时间上限，同样限制 Retry-After，0 表示使用 DefaultMaxRetryDelay
+// Multiplier       每次重试等待时间的增长倍数，0 表示使用 2
+// Jitter           等待时间的随机抖动比例，取值 [0, 1]，0.2 表示在 [0.8d, d] 之间随机
+// RetryStatus      需要重试的响应状态码，为空时使用 DefaultRetryStatus
+// RetryNonIdempotent 是否重试 POST、PATCH 等非幂等请求，带有 Idempotency-Key 请求头的请求总会重试
+// RetryNonIdempotentErrors 是否在传输错误时重试非幂等请求，按状态码重试仍然由 RetryNonIdempotent 决定
+type BackoffPolicy struct {
+    MaxRetries               int
+    BaseDelay                time.Duration
+    MaxDelay                 time.Duration
+    Multiplier               float64
+    Jitter                   float64
+    RetryStatus              []int
+    RetryNonIdempotent       bool
+    RetryNonIdempotentErrors bool
+}
+
+// NewBackoffPolicy returns an idempotent-only policy doubling the delay on every retry with 20% jitter.
+func NewBackoffPolicy(maxRetries int, baseDelay, maxDelay time.Duration) *BackoffPolicy {
+    return &BackoffPolicy{
+        MaxRetries: maxRetries,
+        BaseDelay:  baseDelay,
+        MaxDelay:   maxDelay,
+        Multiplier: 2,
+        Jitter:     0.2,
+    }
+}
+
+func (p *BackoffPolicy) Retry(req *http.Request, resp *http.Response, err error, attempt int) (bool, time.Duration) {
+    if p.MaxRetries != -1 && attempt > p.MaxRetries {
+        return false, 0
+    }
+    // 客户端限流由限流器自己等待，立即失败的请求不再重试
+    if errors.Is(err, ErrRateLimited) {
+        return false, 0
+    }
+    if !p.RetryNonIdempotent && !(err != nil && p.RetryNonIdempotentErrors) && !isIdempotent(req) {
+        return false, 0
+    }
+    // 无法重新生成的请求体不能重试
+    if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+        return false, 0
+    }
+    if err == nil && !p.retryStatus(resp.StatusCode) {
+        return false, 0
+    }
+    delay := p.Backoff(attempt)
+    if resp != nil {
+        // 服务端要求的等待时间同样不超过上限
+        if after, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok && after > delay {
+            delay = after
+            if max := p.maxDelay(); delay > max {
+                delay = max
+            }
+        }
+    }
+    return true, delay
+}
+
+// Backoff returns the delay before the given retry attempt.
+func (p *BackoffPolicy) Backoff(attempt int) time.Duration {
+    multiplier := p.Multiplier
+    if multiplier <= 0 {
+        multiplier = 2
+    }
+    if p.BaseDelay <= 0 {
+        return 0
+    }
+    // 一直重试时 Pow 会溢出为 +Inf，先限制在上限内再转换为 Duration
+    delay := float64(p.BaseDelay) * math.Pow(multiplier, float64(attempt-1))
+    if max := float64(p.maxDelay()); delay > max {
+        delay = max
+    }
+    if p.Jitter > 0 {
+        jitter := math.Min(p.Jitter, 1)
+        delay -= delay * jitter * rand.Float64()
+    }
+    return time.Duration(delay)
+}
+
+func (p *BackoffPolicy) maxDelay() time.Duration {
+    if p.MaxDelay > 0 {
+        return p.MaxDelay
+    }
+    return DefaultMaxRetryDelay
+}
+
+func (p *BackoffPolicy) retryStatus(code int) bool {
+    status := p.RetryStatus
+    if len(status) == 0 {
+        status = DefaultRetryStatus
+    }
+    for _, s := range status {
+        if s == code {
+            return true
+        }
+    }
+    return false
+}
+
+// isIdempotent reports whether the request can be sent again safely.
+func isIdempotent(req *http.Request) bool {
+    switch req.Method {
+    case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+        return true
+    }
+    return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// parseRetryAfter parses the Retry-After header, which is either seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+    if value == "" {
+        return 0, false
+    }
+    if seconds, err := strconv.Atoi(value); err == nil {
+        if seconds < 0 {
+            return 0, false
+        }
+        return time.Duration(seconds) * time.Second, true
+    }
+    if t, err := http.ParseTime(value); err == nil {
+        d := time.Until(t)
+        if d < 0 {
+            d = 0
+        }
+        return d, true
+    }
+    return 0, false
+}
+
+// drainBody reads a bit of the body before closing it, so that the connection can be reused.
+func drainBody(body io.ReadCloser) {
+    if body == nil {
+        return
+    }
+    io.CopyN(ioutil.Discard, body, 4096)
+    body.Close()
+}
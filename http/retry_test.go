@@ -0,0 +1,99 @@
+package http
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// flakyServer fails the first request, by closing the connection when drop is set or else with a 503.
+func flakyServer(drop bool, requests *int32) *httptest.Server {
+    return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if atomic.AddInt32(requests, 1) > 1 {
+            return
+        }
+        if drop {
+            conn, _, _ := w.(http.Hijacker).Hijack()
+            conn.Close()
+            return
+        }
+        w.WriteHeader(http.StatusServiceUnavailable)
+    }))
+}
+
+func TestSetRetries(t *testing.T) {
+    tests := []struct {
+        name     string
+        method   string
+        drop     bool
+        header   string
+        policy   RetryPolicy
+        requests int32
+    }{
+        {name: "GET status", method: http.MethodGet, requests: 2},
+        {name: "POST status", method: http.MethodPost, requests: 1},
+        {name: "POST status with Idempotency-Key", method: http.MethodPost, header: "k1", requests: 2},
+        {name: "POST transport error", method: http.MethodPost, drop: true, requests: 2},
+        {name: "POST status opted in", method: http.MethodPost, requests: 2,
+            policy: &BackoffPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, RetryNonIdempotent: true}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var requests int32
+            srv := flakyServer(tt.drop, &requests)
+            defer srv.Close()
+
+            h, _ := NewHttpClient(nil, srv.URL, tt.method, nil)
+            h.Body("a=1").SetRetries(3, time.Millisecond)
+            if tt.header != "" {
+                h.Header("Idempotency-Key", tt.header)
+            }
+            if tt.policy != nil {
+                h.SetRetryPolicy(tt.policy)
+            }
+            h.Response()
+            if n := atomic.LoadInt32(&requests); n != tt.requests {
+                t.Fatalf("server got %d requests, want %d", n, tt.requests)
+            }
+        })
+    }
+}
+
+func TestBackoffBounded(t *testing.T) {
+    p := &BackoffPolicy{MaxRetries: -1, BaseDelay: time.Second}
+    for _, attempt := range []int{1, 10, 100, 2000, 1 << 30} {
+        if d := p.Backoff(attempt); d <= 0 || d > DefaultMaxRetryDelay {
+            t.Fatalf("attempt %d: delay %s", attempt, d)
+        }
+    }
+    p = &BackoffPolicy{MaxRetries: -1, BaseDelay: time.Second, MaxDelay: 5 * time.Second, Jitter: 0.5}
+    if d := p.Backoff(5000); d < 2500*time.Millisecond || d > 5*time.Second {
+        t.Fatalf("delay %s outside [2.5s, 5s]", d)
+    }
+    if d := (&BackoffPolicy{}).Backoff(5000); d != 0 {
+        t.Fatalf("zero base delay gave %s", d)
+    }
+}
+
+func TestRetryAfterCapped(t *testing.T) {
+    req, _ := http.NewRequest(http.MethodGet, "http://a.com/", nil)
+    resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {"36000"}}}
+    tests := []struct {
+        policy *BackoffPolicy
+        want   time.Duration
+    }{
+        {&BackoffPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}, 10 * time.Second},
+        {&BackoffPolicy{MaxRetries: 3, BaseDelay: time.Second}, DefaultMaxRetryDelay},
+    }
+    for _, tt := range tests {
+        if retry, delay := tt.policy.Retry(req, resp, nil, 1); !retry || delay != tt.want {
+            t.Fatalf("retry %v after %s, want %s", retry, delay, tt.want)
+        }
+    }
+    resp.Header.Set("Retry-After", "3")
+    if _, delay := tests[0].policy.Retry(req, resp, nil, 1); delay != 3*time.Second {
+        t.Fatalf("Retry-After 3 gave %s", delay)
+    }
+}
@@ -0,0 +1,338 @@
+package http
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/md5"
+    "crypto/sha1"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "fmt"
+    "hash"
+    "io"
+    "io/ioutil"
+    "mime"
+    "net/http"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type SignAlgorithm int
+
+const (
+    HMACSHA256 SignAlgorithm = iota
+    HMACSHA1
+    HMACMD5
+    // MD5, SHA1 and SHA256 hash the content with KeyPrefix and Key appended, as many payment and SMS APIs do
+    MD5
+    SHA1
+    SHA256
+)
+
+type SignStyle int
+
+const (
+    // SignCanonical signs the lines METHOD, path, sorted query, sorted form, the signed headers as name:value
+    // and the hex SHA-256 of the body, joined by \n
+    SignCanonical SignStyle = iota
+    // SignParams signs the sorted query and form params joined as k1=v1&k2=v2
+    SignParams
+)
+
+type SignPlacement int
+
+const (
+    SignInHeader SignPlacement = iota
+    // SignInParams adds the signature, timestamp and nonce to the form body of form requests, to the query otherwise
+    SignInParams
+)
+
+// SignInput is what a request signature is computed from.
+type SignInput struct {
+    Method    string
+    Host      string
+    Path      string
+    Query     url.Values
+    Form      url.Values
+    Header    http.Header
+    Body      []byte
+    Timestamp string
+    Nonce     string
+}
+
+// SignConfig signs every attempt of a request, with a new timestamp and nonce each time.
+// Key           密钥
+// Algorithm     签名算法，默认 HMACSHA256
+// Style         待签名内容的拼接方式，默认 SignCanonical
+// Placement     签名、时间戳、随机串放在请求头还是请求参数中，默认请求头
+// Headers       SignCanonical 时参与签名的请求头，放在请求头中的时间戳和随机串总是参与签名
+// BodyHash      SignCanonical 时是否对请求体签名，multipart 请求体不参与签名
+// SignatureName 签名的名称，默认请求头 X-Signature，请求参数 sign
+// TimestampName 时间戳的名称，为空时不添加时间戳
+// NonceName     随机串的名称，为空时不添加随机串
+// Timestamp     时间戳格式，默认秒级 unix 时间戳
+// KeyPrefix     MD5、SHA1、SHA256 算法拼接密钥前的连接串，如 "&key="
+// SkipEmpty     SignParams 时跳过空值参数
+// Exclude       不参与签名的参数，如 sign_type
+// UpperCase     签名转为大写
+// Base64        签名使用 base64 编码，默认 hex
+// Canonicalize  自定义待签名内容，设置后 Style 无效
+type SignConfig struct {
+    Key           string
+    Algorithm     SignAlgorithm
+    Style         SignStyle
+    Placement     SignPlacement
+    Headers       []string
+    BodyHash      bool
+    SignatureName string
+    TimestampName string
+    NonceName     string
+    Timestamp     func(t time.Time) string
+    KeyPrefix     string
+    SkipEmpty     bool
+    Exclude       []string
+    UpperCase     bool
+    Base64        bool
+    Canonicalize  func(in *SignInput) string
+}
+
+// SetSigning signs every attempt of the request by cfg, nil turns signing off.
+func (h *HttpClient) SetSigning(cfg *SignConfig) *HttpClient {
+    h.signing = cfg
+
+    return h
+}
+
+func signingInterceptor(cfg *SignConfig) Interceptor {
+    return func(next Doer) Doer {
+        return DoerFunc(func(req *http.Request) (*http.Response, error) {
+            if err := cfg.Sign(req); err != nil {
+                return nil, err
+            }
+            return next.Do(req)
+        })
+    }
+}
+
+// Sign adds the timestamp, nonce and signature to req, the body of a form request is rewritten
+// when they are placed in the params. The body is only read for form requests, BodyHash and Canonicalize,
+// a multipart body is never read so that uploads keep streaming, it is signed by its params.
+func (cfg *SignConfig) Sign(req *http.Request) error {
+    mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+    isForm := mediaType == "application/x-www-form-urlencoded"
+    isMultipart := mediaType == "multipart/form-data"
+    var (
+        body []byte
+        err  error
+    )
+    if isForm || !isMultipart && (cfg.BodyHash || cfg.Canonicalize != nil) {
+        if body, err = requestBody(req); err != nil {
+            return err
+        }
+    }
+    in := &SignInput{
+        Method: req.Method,
+        Host:   req.Host,
+        Path:   req.URL.EscapedPath(),
+        Query:  req.URL.Query(),
+        Form:   url.Values{},
+        Header: req.Header,
+        Body:   body,
+    }
+    if in.Host == "" {
+        in.Host = req.URL.Host
+    }
+    if in.Path == "" {
+        in.Path = "/"
+    }
+    switch {
+    case isForm:
+        if in.Form, err = url.ParseQuery(string(body)); err != nil {
+            return err
+        }
+    case isMultipart:
+        if h := ClientFromContext(req.Context()); h != nil {
+            in.Form = h.Params()
+        }
+    }
+
+    format := cfg.Timestamp
+    if format == nil {
+        format = func(t time.Time) string { return strconv.FormatInt(t.Unix(), 10) }
+    }
+    in.Timestamp = format(time.Now())
+    in.Nonce = randomHex(16)
+
+    signedHeaders := append([]string(nil), cfg.Headers...)
+    target := in.Query
+    if isForm {
+        target = in.Form
+    }
+    extra := [][2]string{{cfg.TimestampName, in.Timestamp}, {cfg.NonceName, in.Nonce}}
+    for _, kv := range extra {
+        if kv[0] == "" {
+            continue
+        }
+        if cfg.Placement == SignInParams {
+            target.Set(kv[0], kv[1])
+        } else {
+            req.Header.Set(kv[0], kv[1])
+            signedHeaders = append(signedHeaders, kv[0])
+        }
+    }
+
+    var content string
+    switch {
+    case cfg.Canonicalize != nil:
+        content = cfg.Canonicalize(in)
+    case cfg.Style == SignParams:
+        content = cfg.paramsString(in)
+    default:
+        content = cfg.canonicalString(in, signedHeaders)
+    }
+    signature, err := cfg.signature(content)
+    if err != nil {
+        return err
+    }
+
+    name := cfg.SignatureName
+    if cfg.Placement == SignInHeader {
+        if name == "" {
+            name = "X-Signature"
+        }
+        req.Header.Set(name, signature)
+        return nil
+    }
+    if name == "" {
+        name = "sign"
+    }
+    target.Set(name, signature)
+    if isForm {
+        setRequestBody(req, []byte(in.Form.Encode()))
+    }
+    req.URL.RawQuery = in.Query.Encode()
+    return nil
+}
+
+func (cfg *SignConfig) canonicalString(in *SignInput, headers []string) string {
+    var b strings.Builder
+    b.WriteString(in.Method + "\n" + in.Path + "\n" + in.Query.Encode() + "\n" + in.Form.Encode() + "\n")
+    for _, name := range headers {
+        value := in.Header.Get(name)
+        if strings.EqualFold(name, "Host") {
+            value = in.Host
+        }
+        b.WriteString(strings.ToLower(name) + ":" + strings.TrimSpace(value) + "\n")
+    }
+    if cfg.BodyHash {
+        sum := sha256.Sum256(in.Body)
+        b.WriteString(hex.EncodeToString(sum[:]))
+    }
+    return b.String()
+}
+
+// paramsString joins the query and form params sorted by key, values are not escaped.
+func (cfg *SignConfig) paramsString(in *SignInput) string {
+    params := make(map[string][]string)
+    for _, values := range []url.Values{in.Query, in.Form} {
+        for k, vs := range values {
+            params[k] = append(params[k], vs...)
+        }
+    }
+    delete(params, cfg.signatureParam())
+    for _, k := range cfg.Exclude {
+        delete(params, k)
+    }
+    keys := make([]string, 0, len(params))
+    for k := range params {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    pairs := make([]string, 0, len(keys))
+    for _, k := range keys {
+        for _, v := range params[k] {
+            if cfg.SkipEmpty && v == "" {
+                continue
+            }
+            pairs = append(pairs, k+"="+v)
+        }
+    }
+    return strings.Join(pairs, "&")
+}
+
+func (cfg *SignConfig) signatureParam() string {
+    if cfg.SignatureName == "" && cfg.Placement == SignInParams {
+        return "sign"
+    }
+    return cfg.SignatureName
+}
+
+func (cfg *SignConfig) signature(content string) (string, error) {
+    var mac hash.Hash
+    switch cfg.Algorithm {
+    case HMACSHA256:
+        mac = hmac.New(sha256.New, []byte(cfg.Key))
+    case HMACSHA1:
+        mac = hmac.New(sha1.New, []byte(cfg.Key))
+    case HMACMD5:
+        mac = hmac.New(md5.New, []byte(cfg.Key))
+    case MD5:
+        mac = md5.New()
+    case SHA1:
+        mac = sha1.New()
+    case SHA256:
+        mac = sha256.New()
+    default:
+        return "", fmt.Errorf("http: unsupported sign algorithm %d", cfg.Algorithm)
+    }
+    mac.Write([]byte(content))
+    if cfg.Algorithm >= MD5 {
+        mac.Write([]byte(cfg.KeyPrefix + cfg.Key))
+    }
+    sum := mac.Sum(nil)
+    if cfg.Base64 {
+        return base64.StdEncoding.EncodeToString(sum), nil
+    }
+    signature := hex.EncodeToString(sum)
+    if cfg.UpperCase {
+        signature = strings.ToUpper(signature)
+    }
+    return signature, nil
+}
+
+// requestBody returns the body of req without consuming it, a body that cannot be rewound is buffered.
+func requestBody(req *http.Request) ([]byte, error) {
+    if req.Body == nil || req.Body == http.NoBody {
+        return nil, nil
+    }
+    if req.GetBody != nil {
+        rc, err := req.GetBody()
+        if err != nil {
+            return nil, err
+        }
+        defer rc.Close()
+        return ioutil.ReadAll(rc)
+    }
+    body, err := ioutil.ReadAll(req.Body)
+    req.Body.Close()
+    if err != nil {
+        return nil, err
+    }
+    setRequestBody(req, body)
+    return body, nil
+}
+
+func setRequestBody(req *http.Request, body []byte) {
+    req.ContentLength = int64(len(body))
+    req.GetBody = func() (io.ReadCloser, error) {
+        return ioutil.NopCloser(bytes.NewReader(body)), nil
+    }
+    req.Body, _ = req.GetBody()
+    if h := ClientFromContext(req.Context()); h != nil {
+        req.Body = h.wrapBody(req.Body, Upload, req.ContentLength)
+    }
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "runtime"
+    "testing"
+)
+
+func TestSignMultipartStreams(t *testing.T) {
+    var sign string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        sign = r.Header.Get("X-Signature")
+        io.Copy(ioutil.Discard, r.Body)
+    }))
+    defer srv.Close()
+
+    const size = 64 << 20
+    h, err := NewHttpClient(nil, srv.URL, http.MethodPost, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // 不能重复读取的文件流，签名时读取请求体会把它全部缓存到内存中
+    h.Param("a", "1").PostFileReader("file", "big.bin", io.LimitReader(zeroReader{}, size), "")
+    h.SetSigning(&SignConfig{Key: "secret", Style: SignParams})
+
+    var before, after runtime.MemStats
+    runtime.GC()
+    runtime.ReadMemStats(&before)
+    resp, err := h.Response()
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    runtime.ReadMemStats(&after)
+
+    if sign == "" {
+        t.Fatal("request is not signed")
+    }
+    if alloc := after.TotalAlloc - before.TotalAlloc; alloc > size/4 {
+        t.Fatalf("signing a %d bytes upload allocated %d bytes", size, alloc)
+    }
+}
+
+func TestSignForm(t *testing.T) {
+    var got string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        r.ParseForm()
+        got = r.PostForm.Get("sign")
+    }))
+    defer srv.Close()
+
+    cfg := &SignConfig{Key: "k", Algorithm: MD5, Style: SignParams, Placement: SignInParams, KeyPrefix: "&key=", UpperCase: true}
+    h, _ := Post(srv.URL, map[string]string{"b": "2", "a": "1"})
+    if _, err := h.SetSigning(cfg).Bytes(); err != nil {
+        t.Fatal(err)
+    }
+    want, _ := cfg.signature("a=1&b=2")
+    if got != want {
+        t.Fatalf("sign = %q, want %q", got, want)
+    }
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+    for i := range p {
+        p[i] = 0
+    }
+    return len(p), nil
+}
@@ -0,0 +1,283 @@
+package http
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Event is one Server-Sent Event, Event is "message" when the server omits the event field.
+type Event struct {
+    ID    string
+    Event string
+    Data  string
+    Retry time.Duration
+}
+
+// ErrStopStream can be returned by the Subscribe handler to stop consuming the stream without error.
+var ErrStopStream = errors.New("http: stop event stream")
+
+// EventSource consumes a text/event-stream response and reconnects automatically,
+// sending Last-Event-ID and waiting for the retry hint of the server in between.
+type EventSource struct {
+    url           string
+    method        string
+    trans         http.RoundTripper
+    prepare       func(h *HttpClient) error
+    lastEventID   string
+    retry         time.Duration
+    maxReconnects int
+    maxLineSize   int
+}
+
+func NewEventSource(urlPath, method string, trans http.RoundTripper) *EventSource {
+    if method == "" {
+        method = http.MethodGet
+    }
+    return &EventSource{
+        url:           urlPath,
+        method:        method,
+        trans:         trans,
+        retry:         3 * time.Second,
+        maxReconnects: -1,
+        maxLineSize:   1 << 20,
+    }
+}
+
+// SetPrepare sets the function called with the client of every connection,
+// use it to add headers, a JSON body, authentication and so on.
+func (s *EventSource) SetPrepare(prepare func(h *HttpClient) error) *EventSource {
+    s.prepare = prepare
+
+    return s
+}
+
+// SetRetry sets the reconnect delay used until the server sends a retry field, default 3s.
+func (s *EventSource) SetRetry(retry time.Duration) *EventSource {
+    s.retry = retry
+
+    return s
+}
+
+// SetLastEventID sets the Last-Event-ID of the first connection, to resume from a known event.
+func (s *EventSource) SetLastEventID(id string) *EventSource {
+    s.lastEventID = id
+
+    return s
+}
+
+// SetMaxReconnects limits the number of consecutive failed reconnects, -1 (the default) reconnects forever.
+func (s *EventSource) SetMaxReconnects(n int) *EventSource {
+    s.maxReconnects = n
+
+    return s
+}
+
+// SetMaxLineSize sets the longest line accepted in the stream, default 1MB.
+func (s *EventSource) SetMaxLineSize(size int) *EventSource {
+    s.maxLineSize = size
+
+    return s
+}
+
+// LastEventID returns the id of the last event received.
+func (s *EventSource) LastEventID() string {
+    return s.lastEventID
+}
+
+// Subscribe consumes the stream and calls fn for every event until ctx is done, the server answers 204,
+// or fn returns an error. It returns nil when fn returns ErrStopStream.
+func (s *EventSource) Subscribe(ctx context.Context, fn func(ev Event) error) error {
+    failures := 0
+    for {
+        received, err := s.connect(ctx, fn)
+        if err == errStreamDone || errors.Is(err, ErrStopStream) {
+            return nil
+        }
+        var fatal *streamError
+        if errors.As(err, &fatal) {
+            return fatal.err
+        }
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+        if received {
+            failures = 0
+        } else {
+            failures++
+        }
+        if s.maxReconnects >= 0 && failures > s.maxReconnects {
+            if err == nil {
+                err = errors.New("http: event stream closed")
+            }
+            return err
+        }
+        t := time.NewTimer(s.retry)
+        select {
+        case <-ctx.Done():
+            t.Stop()
+            return ctx.Err()
+        case <-t.C:
+        }
+    }
+}
+
+// Events consumes the stream in a goroutine, the event channel is closed when the stream ends
+// and the error channel receives the result of Subscribe.
+func (s *EventSource) Events(ctx context.Context) (<-chan Event, <-chan error) {
+    events := make(chan Event)
+    errc := make(chan error, 1)
+    go func() {
+        defer close(events)
+        errc <- s.Subscribe(ctx, func(ev Event) error {
+            select {
+            case events <- ev:
+                return nil
+            case <-ctx.Done():
+                return ctx.Err()
+            }
+        })
+    }()
+    return events, errc
+}
+
+var errStreamDone = errors.New("http: event stream done")
+
+// streamError is an error that must not be retried by reconnecting.
+type streamError struct {
+    err error
+}
+
+func (e *streamError) Error() string {
+    return e.err.Error()
+}
+
+func (e *streamError) Unwrap() error {
+    return e.err
+}
+
+// connect opens one connection and dispatches its events, received reports whether any event arrived.
+func (s *EventSource) connect(ctx context.Context, fn func(ev Event) error) (received bool, err error) {
+    h, err := NewHttpClient(ctx, s.url, s.method, s.trans)
+    if err != nil {
+        return false, &streamError{err: err}
+    }
+    h.Header("Accept", "text/event-stream").Header("Cache-Control", "no-cache")
+    if s.prepare != nil {
+        if err = s.prepare(h); err != nil {
+            return false, &streamError{err: err}
+        }
+    }
+    if s.lastEventID != "" {
+        h.Header("Last-Event-ID", s.lastEventID)
+    }
+    resp, err := h.getResponse()
+    if err != nil {
+        return false, err
+    }
+    switch {
+    case resp.StatusCode == http.StatusNoContent:
+        drainBody(resp.Body)
+        return false, errStreamDone
+    case resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests:
+        return false, h.newHTTPError(resp, resp.Body)
+    case resp.StatusCode != http.StatusOK:
+        return false, &streamError{err: h.newHTTPError(resp, resp.Body)}
+    case !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"):
+        drainBody(resp.Body)
+        return false, &streamError{err: fmt.Errorf("http: unexpected event stream content type %q", resp.Header.Get("Content-Type"))}
+    }
+    body, err := h.bodyReader()
+    if err != nil {
+        return false, err
+    }
+    defer body.Close()
+
+    scanner := bufio.NewScanner(body)
+    scanner.Buffer(make([]byte, 0, 4096), s.maxLineSize)
+    scanner.Split(scanEventLines)
+    var (
+        ev   = Event{}
+        data bytes.Buffer
+    )
+    for scanner.Scan() {
+        line := scanner.Text()
+        if line == "" {
+            // 空行表示一个事件结束
+            if data.Len() > 0 {
+                ev.ID = s.lastEventID
+                ev.Data = strings.TrimSuffix(data.String(), "\n")
+                if ev.Event == "" {
+                    ev.Event = "message"
+                }
+                received = true
+                if err = fn(ev); err != nil {
+                    return received, &streamError{err: err}
+                }
+            }
+            ev = Event{}
+            data.Reset()
+            continue
+        }
+        if strings.HasPrefix(line, ":") {
+            continue
+        }
+        field, value := line, ""
+        if i := strings.IndexByte(line, ':'); i >= 0 {
+            field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+        }
+        switch field {
+        case "event":
+            ev.Event = value
+        case "data":
+            data.WriteString(value)
+            data.WriteByte('\n')
+        case "id":
+            if !strings.ContainsRune(value, 0) {
+                s.lastEventID = value
+            }
+        case "retry":
+            if ms, er := strconv.Atoi(value); er == nil && ms >= 0 {
+                s.retry = time.Duration(ms) * time.Millisecond
+                ev.Retry = s.retry
+            }
+        }
+    }
+    if err = scanner.Err(); err != nil && errors.Is(err, bufio.ErrTooLong) {
+        return received, &streamError{err: err}
+    }
+    return received, err
+}
+
+// scanEventLines splits the stream into lines ending with \r\n, \n or \r.
+func scanEventLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+    if atEOF && len(data) == 0 {
+        return 0, nil, nil
+    }
+    if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+        if data[i] == '\n' {
+            return i + 1, data[:i], nil
+        }
+        // \r 后面需要再看一个字节判断是否为 \r\n
+        if i+1 < len(data) {
+            if data[i+1] == '\n' {
+                return i + 2, data[:i], nil
+            }
+            return i + 1, data[:i], nil
+        }
+        if atEOF {
+            return i + 1, data[:i], nil
+        }
+        return 0, nil, nil
+    }
+    if atEOF {
+        return len(data), data, nil
+    }
+    return 0, nil, nil
+}
@@ -0,0 +1,118 @@
+package http
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestEventSourceFields(t *testing.T) {
+    var (
+        conns  int32
+        lastID atomic.Value
+    )
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if atomic.AddInt32(&conns, 1) > 1 {
+            lastID.Store(r.Header.Get("Last-Event-ID"))
+            w.WriteHeader(http.StatusNoContent)
+            return
+        }
+        w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+        // 混用 \n、\r\n、\r 换行，注释、未知字段、不带冒号的字段以及没有 data 的事件
+        fmt.Fprint(w, ": comment\n"+
+            "data: first\n\n"+
+            "event: update\r\nid: 1\r\ndata:no space\r\ndata:  two spaces\r\n\r\n"+
+            "retry: 10\rid: 2\rfoo: bar\r\r"+
+            "data\nid: 3\nretry: x\n\n"+
+            "data: tail without blank line")
+    }))
+    defer srv.Close()
+
+    var events []Event
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    // 默认重连间隔一小时，只有 retry 字段生效才能在超时前重连
+    s := NewEventSource(srv.URL, "", nil).SetRetry(time.Hour)
+    err := s.Subscribe(ctx, func(ev Event) error {
+        events = append(events, ev)
+        return nil
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []Event{
+        {Event: "message", Data: "first"},
+        {ID: "1", Event: "update", Data: "no space\n two spaces"},
+        {ID: "3", Event: "message", Data: ""},
+    }
+    if !reflect.DeepEqual(events, want) {
+        t.Fatalf("events = %+v", events)
+    }
+    if id, _ := lastID.Load().(string); id != "3" || s.LastEventID() != "3" {
+        t.Fatalf("reconnected with Last-Event-ID %q", id)
+    }
+}
+
+func TestEventSourceReconnect(t *testing.T) {
+    var conns int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/flaky":
+            // 第一次连接失败，之后从 Last-Event-ID 继续
+            n := atomic.AddInt32(&conns, 1)
+            if n == 1 {
+                w.WriteHeader(http.StatusServiceUnavailable)
+                return
+            }
+            w.Header().Set("Content-Type", "text/event-stream")
+            fmt.Fprintf(w, "id: %d\ndata: after %s\n\n", n, r.Header.Get("Last-Event-ID"))
+        case "/down":
+            atomic.AddInt32(&conns, 1)
+            w.WriteHeader(http.StatusBadGateway)
+        case "/missing":
+            w.WriteHeader(http.StatusNotFound)
+        case "/html":
+            w.Header().Set("Content-Type", "text/html")
+        }
+    }))
+    defer srv.Close()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    var data []string
+    err := NewEventSource(srv.URL+"/flaky", "", nil).SetRetry(time.Millisecond).SetLastEventID("0").
+        Subscribe(ctx, func(ev Event) error {
+            data = append(data, ev.Data)
+            if len(data) == 3 {
+                return ErrStopStream
+            }
+            return nil
+        })
+    if err != nil || !reflect.DeepEqual(data, []string{"after 0", "after 2", "after 3"}) {
+        t.Fatalf("got %v, %v", data, err)
+    }
+
+    // 连续失败超过上限后返回最后一次的错误
+    atomic.StoreInt32(&conns, 0)
+    err = NewEventSource(srv.URL+"/down", "", nil).SetRetry(time.Millisecond).SetMaxReconnects(2).
+        Subscribe(ctx, func(ev Event) error { return nil })
+    var httpErr *HTTPError
+    if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadGateway || atomic.LoadInt32(&conns) != 3 {
+        t.Fatalf("got %v after %d connections", err, conns)
+    }
+
+    // 4xx 以及错误的 Content-Type 不重连
+    for _, path := range []string{"/missing", "/html"} {
+        err = NewEventSource(srv.URL+path, "", nil).SetRetry(time.Hour).
+            Subscribe(ctx, func(ev Event) error { return nil })
+        if err == nil || ctx.Err() != nil {
+            t.Fatalf("%s: got %v", path, err)
+        }
+    }
+}
@@ -0,0 +1,168 @@
+package http
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+)
+
+// LineReader iterates over the response body line by line without buffering the whole body.
+//     lines, err := client.Lines(64 << 10)
+//     defer lines.Close()
+//     for lines.Next() {
+//         fmt.Println(lines.Text())
+//     }
+//     err = lines.Err()
+type LineReader struct {
+    body    io.ReadCloser
+    scanner *bufio.Scanner
+}
+
+// Lines returns a line iterator over the response body, a line longer than maxLineSize fails with bufio.ErrTooLong.
+// maxLineSize <= 0 uses the bufio default of 64KB. gzip is decoded when SetGzipOn(true) is set.
+func (h *HttpClient) Lines(maxLineSize int) (*LineReader, error) {
+    body, err := h.bodyReader()
+    if err != nil {
+        return nil, err
+    }
+    if body == nil {
+        body = http.NoBody
+    }
+    scanner := bufio.NewScanner(body)
+    if maxLineSize > 0 {
+        scanner.Buffer(make([]byte, 0, minInt(maxLineSize, 4096)), maxLineSize)
+    }
+    return &LineReader{body: body, scanner: scanner}, nil
+}
+
+// Next advances to the next line, it returns false at the end of the body or on error.
+func (r *LineReader) Next() bool {
+    return r.scanner.Scan()
+}
+
+// Bytes returns the current line without the line ending, it is only valid until the next call of Next.
+func (r *LineReader) Bytes() []byte {
+    return r.scanner.Bytes()
+}
+
+// Text returns the current line without the line ending.
+func (r *LineReader) Text() string {
+    return r.scanner.Text()
+}
+
+// Err returns the first error met by Next, nil at the end of the body.
+func (r *LineReader) Err() error {
+    return r.scanner.Err()
+}
+
+func (r *LineReader) Close() error {
+    return r.body.Close()
+}
+
+// JSONLinesDecoder decodes an NDJSON body, one value per line, blank lines are skipped.
+type JSONLinesDecoder struct {
+    lines *LineReader
+    line  int
+}
+
+// JSONLines returns a decoder over the NDJSON response body, see Lines for maxLineSize.
+func (h *HttpClient) JSONLines(maxLineSize int) (*JSONLinesDecoder, error) {
+    lines, err := h.Lines(maxLineSize)
+    if err != nil {
+        return nil, err
+    }
+    return &JSONLinesDecoder{lines: lines}, nil
+}
+
+// Decode decodes the next line into v, it returns io.EOF when the body is finished.
+func (d *JSONLinesDecoder) Decode(v interface{}) error {
+    for d.lines.Next() {
+        d.line++
+        line := bytes.TrimSpace(d.lines.Bytes())
+        if len(line) == 0 {
+            continue
+        }
+        if err := json.Unmarshal(line, v); err != nil {
+            return fmt.Errorf("http: decode json line %d: %w", d.line, err)
+        }
+        return nil
+    }
+    if err := d.lines.Err(); err != nil {
+        return err
+    }
+    return io.EOF
+}
+
+func (d *JSONLinesDecoder) Close() error {
+    return d.lines.Close()
+}
+
+// JSONArrayDecoder walks a top-level JSON array element by element.
+//     arr, err := client.JSONArray()
+//     defer arr.Close()
+//     for {
+//         var item Item
+//         if err = arr.Decode(&item); err == io.EOF {
+//             break
+//         } else if err != nil {
+//             return err
+//         }
+//     }
+type JSONArrayDecoder struct {
+    body    io.ReadCloser
+    dec     *json.Decoder
+    started bool
+    done    bool
+}
+
+// JSONArray returns a decoder over the response body, which must be a JSON array.
+// gzip is decoded when SetGzipOn(true) is set.
+func (h *HttpClient) JSONArray() (*JSONArrayDecoder, error) {
+    body, err := h.bodyReader()
+    if err != nil {
+        return nil, err
+    }
+    if body == nil {
+        body = http.NoBody
+    }
+    return &JSONArrayDecoder{body: body, dec: json.NewDecoder(body)}, nil
+}
+
+// Decode decodes the next element of the array into v, it returns io.EOF after the last element.
+func (d *JSONArrayDecoder) Decode(v interface{}) error {
+    if d.done {
+        return io.EOF
+    }
+    if !d.started {
+        tok, err := d.dec.Token()
+        if err != nil {
+            return err
+        }
+        if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+            return fmt.Errorf("http: expected a JSON array, got %v", tok)
+        }
+        d.started = true
+    }
+    if !d.dec.More() {
+        if _, err := d.dec.Token(); err != nil {
+            return err
+        }
+        d.done = true
+        return io.EOF
+    }
+    return d.dec.Decode(v)
+}
+
+func (d *JSONArrayDecoder) Close() error {
+    return d.body.Close()
+}
+
+func minInt(a, b int) int {
+    if a < b {
+        return a
+    }
+    return b
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+    "bufio"
+    "errors"
+    "io"
+    "reflect"
+    "strings"
+    "testing"
+
+    "github.com/reaburoa/utils/http/mockserver"
+)
+
+type streamItem struct {
+    ID   int    `json:"id"`
+    Name string `json:"name"`
+}
+
+func TestJSONLinesMockServer(t *testing.T) {
+    srv := mockserver.New()
+    defer srv.Close()
+    srv.Expect("GET", "/items").Reply(200).Body("{\"id\":1,\"name\":\"a\"}\r\n\n  \n{\"id\":2,\"name\":\"b\"}\n{\"id\":3}").Gzip()
+    srv.Expect("GET", "/broken").Reply(200).Body("{\"id\":1}\n\n{\"id\":\n")
+    srv.Expect("GET", "/long").Reply(200).Body(`{"name":"` + strings.Repeat("x", 100) + `"}`)
+
+    h, _ := Get(srv.URL + "/items")
+    dec, err := h.Header("Accept-Encoding", "gzip").SetGzipOn(true).JSONLines(0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var items []streamItem
+    for {
+        var item streamItem
+        if err = dec.Decode(&item); err == io.EOF {
+            break
+        } else if err != nil {
+            t.Fatal(err)
+        }
+        items = append(items, item)
+    }
+    dec.Close()
+    if want := []streamItem{{1, "a"}, {2, "b"}, {3, ""}}; !reflect.DeepEqual(items, want) {
+        t.Fatalf("items = %+v", items)
+    }
+
+    // 错误信息带上行号，空行也计数
+    h, _ = Get(srv.URL + "/broken")
+    dec, _ = h.JSONLines(0)
+    defer dec.Close()
+    var item streamItem
+    if err = dec.Decode(&item); err != nil || item.ID != 1 {
+        t.Fatalf("got %+v, %v", item, err)
+    }
+    if err = dec.Decode(&item); err == nil || !strings.Contains(err.Error(), "line 3") {
+        t.Fatalf("got %v", err)
+    }
+
+    h, _ = Get(srv.URL + "/long")
+    dec, _ = h.JSONLines(64)
+    defer dec.Close()
+    if err = dec.Decode(&item); !errors.Is(err, bufio.ErrTooLong) {
+        t.Fatalf("got %v", err)
+    }
+    srv.AssertExpectations(t)
+}
+
+func TestJSONArrayMockServer(t *testing.T) {
+    srv := mockserver.New()
+    defer srv.Close()
+    srv.Expect("GET", "/items").Reply(200).Body(` [{"id":1,"name":"a"}, {"id":2}] `)
+    srv.Expect("GET", "/empty").Reply(200).Body(`[]`)
+    srv.Expect("GET", "/object").Reply(200).Body(`{"id":1}`)
+
+    h, _ := Get(srv.URL + "/items")
+    arr, err := h.JSONArray()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer arr.Close()
+    var items []streamItem
+    for {
+        var item streamItem
+        if err = arr.Decode(&item); err == io.EOF {
+            break
+        } else if err != nil {
+            t.Fatal(err)
+        }
+        items = append(items, item)
+    }
+    if want := []streamItem{{1, "a"}, {2, ""}}; !reflect.DeepEqual(items, want) {
+        t.Fatalf("items = %+v", items)
+    }
+    if err = arr.Decode(&streamItem{}); err != io.EOF {
+        t.Fatalf("decode after the end: %v", err)
+    }
+
+    h, _ = Get(srv.URL + "/empty")
+    arr, _ = h.JSONArray()
+    defer arr.Close()
+    if err = arr.Decode(&streamItem{}); err != io.EOF {
+        t.Fatalf("empty array: %v", err)
+    }
+
+    h, _ = Get(srv.URL + "/object")
+    arr, _ = h.JSONArray()
+    defer arr.Close()
+    if err = arr.Decode(&streamItem{}); err == nil || err == io.EOF {
+        t.Fatalf("object: %v", err)
+    }
+}
@@ -0,0 +1,50 @@
+package http
+
+import (
+    "net/http"
+
+    "github.com/opentracing/opentracing-go"
+    "github.com/opentracing/opentracing-go/ext"
+    "github.com/opentracing/opentracing-go/log"
+)
+
+// SetTracing turns the automatic OpenTracing client span on or off, it is on by default.
+// The span is only started when the context of the client carries a span.
+func (h *HttpClient) SetTracing(on bool) *HttpClient {
+    h.disableTracing = !on
+
+    return h
+}
+
+// tracingInterceptor starts a child client span of the span in the request context for every attempt,
+// and injects it into the request headers with the global tracer set up by open_trace.InitTrace.
+func tracingInterceptor(next Doer) Doer {
+    return DoerFunc(func(req *http.Request) (*http.Response, error) {
+        parent := opentracing.SpanFromContext(req.Context())
+        if parent == nil {
+            return next.Do(req)
+        }
+        tracer := opentracing.GlobalTracer()
+        span := tracer.StartSpan("HTTP "+req.Method, opentracing.ChildOf(parent.Context()))
+        defer span.Finish()
+        ext.SpanKindRPCClient.Set(span)
+        ext.HTTPUrl.Set(span, req.URL.String())
+        ext.HTTPMethod.Set(span, req.Method)
+        if attempt := AttemptFromContext(req.Context()); attempt > 0 {
+            span.SetTag("http.attempt", attempt)
+        }
+        tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+
+        resp, err := next.Do(req.WithContext(opentracing.ContextWithSpan(req.Context(), span)))
+        if err != nil {
+            ext.Error.Set(span, true)
+            span.LogFields(log.Error(err))
+            return resp, err
+        }
+        ext.HTTPStatusCode.Set(span, uint16(resp.StatusCode))
+        if resp.StatusCode >= http.StatusInternalServerError {
+            ext.Error.Set(span, true)
+        }
+        return resp, nil
+    })
+}
@@ -0,0 +1,281 @@
+package http
+
+import (
+    "encoding"
+    "fmt"
+    "net/url"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// EncodeValues encodes the exported fields of a struct, or a pointer to one, into url.Values.
+// The key of a field is set by the url tag, the field name is used without tag:
+//     type Query struct {
+//         IDs     []int     `url:"id"`                // id=1&id=2
+//         Tags    []string  `url:"tags,comma"`        // tags=a,b
+//         Since   time.Time `url:"since,omitempty"`   // RFC3339, unix or unixmilli set the format
+//         Page    *int      `url:"page,omitempty"`    // nil pointers are skipped
+//         Debug   bool      `url:"debug,int"`         // 1 or 0 instead of true or false
+//         Filter  Filter    `url:"filter"`            // filter[name]=...
+//         Ignored string    `url:"-"`
+//     }
+// Embedded structs are flattened, maps are encoded as key[mapKey].
+func EncodeValues(v interface{}) (url.Values, error) {
+    values := make(url.Values)
+    rv := reflect.ValueOf(v)
+    for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+        if rv.IsNil() {
+            return values, nil
+        }
+        rv = rv.Elem()
+    }
+    if rv.Kind() != reflect.Struct {
+        return nil, fmt.Errorf("http: EncodeValues expects a struct, got %s", rv.Kind())
+    }
+    if err := encodeStruct(values, rv, "", "url"); err != nil {
+        return nil, err
+    }
+    return values, nil
+}
+
+type tagOptions []string
+
+func (o tagOptions) has(opt string) bool {
+    for _, v := range o {
+        if v == opt {
+            return true
+        }
+    }
+    return false
+}
+
+func parseTag(field reflect.StructField, tagName string) (string, tagOptions) {
+    tag := field.Tag.Get(tagName)
+    parts := strings.Split(tag, ",")
+    name := parts[0]
+    if name == "" {
+        name = field.Name
+    }
+    return name, tagOptions(parts[1:])
+}
+
+var (
+    timeType          = reflect.TypeOf(time.Time{})
+    textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func encodeStruct(values url.Values, rv reflect.Value, prefix, tagName string) error {
+    rt := rv.Type()
+    for i := 0; i < rt.NumField(); i++ {
+        field := rt.Field(i)
+        if field.PkgPath != "" && !field.Anonymous {
+            continue
+        }
+        if field.Tag.Get(tagName) == "-" {
+            continue
+        }
+        name, opts := parseTag(field, tagName)
+        fv := rv.Field(i)
+        if opts.has("omitempty") && fv.IsZero() {
+            continue
+        }
+        // 匿名嵌入且没有指定名称的结构体字段直接展开
+        if field.Anonymous && field.Tag.Get(tagName) == "" {
+            for fv.Kind() == reflect.Ptr {
+                if fv.IsNil() {
+                    break
+                }
+                fv = fv.Elem()
+            }
+            if fv.Kind() == reflect.Struct {
+                if err := encodeStruct(values, fv, prefix, tagName); err != nil {
+                    return err
+                }
+                continue
+            }
+        }
+        if prefix != "" {
+            name = prefix + "[" + name + "]"
+        }
+        if err := encodeField(values, name, fv, opts, tagName); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func encodeField(values url.Values, name string, fv reflect.Value, opts tagOptions, tagName string) error {
+    for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+        if fv.IsNil() {
+            return nil
+        }
+        fv = fv.Elem()
+    }
+    if fv.Type() == timeType || fv.Type().Implements(textMarshalerType) {
+        s, err := formatScalar(fv, opts)
+        if err != nil {
+            return err
+        }
+        values.Add(name, s)
+        return nil
+    }
+    switch fv.Kind() {
+    case reflect.Slice, reflect.Array:
+        if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Uint8 {
+            values.Add(name, string(fv.Bytes()))
+            return nil
+        }
+        items := make([]string, 0, fv.Len())
+        for i := 0; i < fv.Len(); i++ {
+            item := fv.Index(i)
+            for item.Kind() == reflect.Ptr && !item.IsNil() {
+                item = item.Elem()
+            }
+            if item.Kind() == reflect.Struct && item.Type() != timeType {
+                if err := encodeStruct(values, item, fmt.Sprintf("%s[%d]", name, i), tagName); err != nil {
+                    return err
+                }
+                continue
+            }
+            s, err := formatScalar(item, opts)
+            if err != nil {
+                return err
+            }
+            items = append(items, s)
+        }
+        if opts.has("comma") {
+            if len(items) > 0 {
+                values.Add(name, strings.Join(items, ","))
+            }
+            return nil
+        }
+        for _, s := range items {
+            values.Add(name, s)
+        }
+        return nil
+    case reflect.Map:
+        keys := fv.MapKeys()
+        for _, k := range keys {
+            if err := encodeField(values, fmt.Sprintf("%s[%v]", name, k.Interface()), fv.MapIndex(k), opts, tagName); err != nil {
+                return err
+            }
+        }
+        return nil
+    case reflect.Struct:
+        return encodeStruct(values, fv, name, tagName)
+    }
+    s, err := formatScalar(fv, opts)
+    if err != nil {
+        return err
+    }
+    values.Add(name, s)
+    return nil
+}
+
+func formatScalar(fv reflect.Value, opts tagOptions) (string, error) {
+    for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+        if fv.IsNil() {
+            return "", nil
+        }
+        fv = fv.Elem()
+    }
+    if fv.Type() == timeType {
+        t := fv.Interface().(time.Time)
+        switch {
+        case opts.has("unix"):
+            return strconv.FormatInt(t.Unix(), 10), nil
+        case opts.has("unixmilli"):
+            return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10), nil
+        }
+        return t.Format(time.RFC3339), nil
+    }
+    if fv.Type().Implements(textMarshalerType) {
+        b, err := fv.Interface().(encoding.TextMarshaler).MarshalText()
+        return string(b), err
+    }
+    switch fv.Kind() {
+    case reflect.String:
+        return fv.String(), nil
+    case reflect.Bool:
+        if opts.has("int") {
+            if fv.Bool() {
+                return "1", nil
+            }
+            return "0", nil
+        }
+        return strconv.FormatBool(fv.Bool()), nil
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return strconv.FormatInt(fv.Int(), 10), nil
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+        return strconv.FormatUint(fv.Uint(), 10), nil
+    case reflect.Float32:
+        return strconv.FormatFloat(fv.Float(), 'f', -1, 32), nil
+    case reflect.Float64:
+        return strconv.FormatFloat(fv.Float(), 'f', -1, 64), nil
+    }
+    return "", fmt.Errorf("http: unsupported value type %s", fv.Type())
+}
+
+// QueryStruct encodes v by EncodeValues into the query string, whatever the method is.
+func (h *HttpClient) QueryStruct(v interface{}) (*HttpClient, error) {
+    values, err := EncodeValues(v)
+    if err != nil {
+        return h, err
+    }
+    if h.query == nil {
+        h.query = make(url.Values)
+    }
+    for k, vs := range values {
+        h.query[k] = append(h.query[k], vs...)
+    }
+    return h, nil
+}
+
+// FormStruct encodes v by EncodeValues into the params, which are sent as the form body of
+// POST, PUT, PATCH and DELETE requests and as the query string of GET requests.
+func (h *HttpClient) FormStruct(v interface{}) (*HttpClient, error) {
+    values, err := EncodeValues(v)
+    if err != nil {
+        return h, err
+    }
+    for k, vs := range values {
+        for _, vv := range vs {
+            h.Param(k, vv)
+        }
+    }
+    return h, nil
+}
+
+// PathParam fills {key} in the url with the escaped value.
+func (h *HttpClient) PathParam(key, value string) *HttpClient {
+    h.url = strings.ReplaceAll(h.url, "{"+key+"}", url.PathEscape(value))
+
+    return h
+}
+
+// PathStruct fills the url templates like /orders/{id} from the fields tagged `path:"id"`.
+func (h *HttpClient) PathStruct(v interface{}) (*HttpClient, error) {
+    rv := reflect.ValueOf(v)
+    for rv.Kind() == reflect.Ptr {
+        if rv.IsNil() {
+            return h, nil
+        }
+        rv = rv.Elem()
+    }
+    if rv.Kind() != reflect.Struct {
+        return h, fmt.Errorf("http: PathStruct expects a struct, got %s", rv.Kind())
+    }
+    values := make(url.Values)
+    if err := encodeStruct(values, rv, "", "path"); err != nil {
+        return h, err
+    }
+    for k := range values {
+        h.PathParam(k, values.Get(k))
+    }
+    if strings.Contains(h.url, "{") {
+        return h, fmt.Errorf("http: unfilled path params in %s", h.url)
+    }
+    return h, nil
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "reflect"
+    "testing"
+    "time"
+)
+
+type valuesFilter struct {
+    Name string `url:"name"`
+    Min  int    `url:"min,omitempty"`
+}
+
+type valuesPage struct {
+    Page int `url:"page"`
+    Size int `url:"size,omitempty"`
+}
+
+type valuesQuery struct {
+    valuesPage
+    IDs      []int             `url:"id"`
+    Tags     []string          `url:"tags,comma"`
+    Since    time.Time         `url:"since"`
+    Until    time.Time         `url:"until,unix"`
+    Cursor   *int              `url:"cursor,omitempty"`
+    Debug    bool              `url:"debug,int"`
+    Verbose  bool              `url:"verbose"`
+    Filter   valuesFilter      `url:"filter"`
+    Items    []valuesFilter    `url:"items"`
+    Labels   map[string]string `url:"labels"`
+    IP       net.IP            `url:"ip"`
+    Raw      []byte            `url:"raw"`
+    Ratio    float32           `url:"ratio"`
+    Ignored  string            `url:"-"`
+    NoTag    uint8
+    internal string
+}
+
+func TestEncodeValues(t *testing.T) {
+    since := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+    got, err := EncodeValues(&valuesQuery{
+        valuesPage: valuesPage{Page: 2},
+        IDs:        []int{1, 2},
+        Tags:       []string{"a", "b"},
+        Since:      since,
+        Until:      since,
+        Debug:      true,
+        Filter:     valuesFilter{Name: "tom"},
+        Items:      []valuesFilter{{Name: "x", Min: 1}},
+        Labels:     map[string]string{"env": "prod"},
+        IP:         net.ParseIP("10.0.0.1"),
+        Raw:        []byte("raw"),
+        Ratio:      0.1,
+        Ignored:    "ignored",
+        NoTag:      7,
+        internal:   "internal",
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := url.Values{
+        "page":           {"2"},
+        "id":             {"1", "2"},
+        "tags":           {"a,b"},
+        "since":          {"2024-05-01T08:00:00Z"},
+        "until":          {"1714550400"},
+        "debug":          {"1"},
+        "verbose":        {"false"},
+        "filter[name]":   {"tom"},
+        "items[0][name]": {"x"},
+        "items[0][min]":  {"1"},
+        "labels[env]":    {"prod"},
+        "ip":             {"10.0.0.1"},
+        "raw":            {"raw"},
+        "ratio":          {"0.1"},
+        "NoTag":          {"7"},
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Fatalf("EncodeValues = %v\nwant %v", got, want)
+    }
+
+    if values, err := EncodeValues((*valuesQuery)(nil)); err != nil || len(values) != 0 {
+        t.Fatalf("nil pointer: %v, %v", values, err)
+    }
+    if _, err := EncodeValues(map[string]string{}); err == nil {
+        t.Fatal("a map is encoded")
+    }
+    if _, err := EncodeValues(struct{ C chan int }{make(chan int)}); err == nil {
+        t.Fatal("a channel is encoded")
+    }
+}
+
+func TestStructParams(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        r.ParseForm()
+        w.Write([]byte(r.URL.EscapedPath() + "?" + r.URL.RawQuery + " " + r.PostForm.Encode()))
+    }))
+    defer srv.Close()
+
+    h, _ := NewHttpClient(nil, srv.URL+"/orgs/{org}/orders/{id}", http.MethodPost, nil)
+    if _, err := h.PathStruct(struct {
+        Org string `path:"org"`
+        ID  int    `path:"id"`
+    }{"a/b", 42}); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := h.QueryStruct(valuesPage{Page: 1}); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := h.FormStruct(valuesFilter{Name: "tom", Min: 3}); err != nil {
+        t.Fatal(err)
+    }
+    body, err := h.Bytes()
+    if err != nil || string(body) != "/orgs/a%2Fb/orders/42?page=1 min=3&name=tom" {
+        t.Fatalf("got %q, %v", body, err)
+    }
+
+    h, _ = NewHttpClient(nil, srv.URL+"/orders/{id}", http.MethodGet, nil)
+    if _, err = h.PathStruct(struct {
+        Other string `path:"other"`
+    }{"x"}); err == nil {
+        t.Fatal("unfilled path params are accepted")
+    }
+}
@@ -62,7 +62,7 @@ func InitTrace(traceCfg *TraceConfig) io.Closer {
     
     // metrics 监控
     if traceCfg.Metrics != nil {
-        jMetrics = metrics.NullFactory
+        jMetrics = traceCfg.Metrics
     } else {
         jMetrics = metrics.NullFactory
     }